@@ -2,7 +2,6 @@ package api
 
 import (
 	"crypto/md5"
-	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -22,6 +21,8 @@ var (
 	ErrParseCountFailure = echo.NewHTTPError(http.StatusBadRequest, "Failed to parse count")
 	// ErrParseDurationFailure is thrown when we fail to parse a duration
 	ErrParseDurationFailure = echo.NewHTTPError(http.StatusBadRequest, "Failed to parse duration")
+	// ErrInvalidTimezone is thrown when we fail to load a requested timezone
+	ErrInvalidTimezone = echo.NewHTTPError(http.StatusBadRequest, "Invalid IANA timezone")
 	// ErrCountSumFailure is thrown when we fail to retrieve the Action count sum
 	ErrCountSumFailure = echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve Action count")
 )
@@ -31,12 +32,16 @@ type Action struct {
 	ID        string    `gorm:"primary_key" gorm:"primary_key;unique_index"`
 	AppID     string    `sql:"index" gorm:"type:varchar(10);not null"`
 	Action    string    `sql:"index" gorm:"type:varchar(100);not null"`
+	Tags      string    `gorm:"type:varchar(329);not null;default:''"` // Fits 5 tags of 32 character keys and values
 	Count     int64     `gorm:"not null"`
 	Timestamp time.Time `sql:"index"`
 }
 
-// CreateAction increments the database value for the pas
-// Endpoint: /action/:app_id/:metric/create?token=:token
+// CreateAction increments the database value for the pas. Tags may be
+// attached to the action formatted as key:value,key:value. The time
+// the action occurred may be passed as RFC3339 or unix seconds and
+// defaults to now
+// Endpoint: /action/:app_id/:metric/create?token=:token&tags=:tags&timestamp=:timestamp
 func (s *Service) CreateAction(c echo.Context) error {
 	l := s.logger.WithField("method", "create_action")
 	l.Debug("Received new CreateAction request")
@@ -49,15 +54,46 @@ func (s *Service) CreateAction(c echo.Context) error {
 		l.WithError(err).Error("Failed to parse requested count")
 		return ErrParseCountFailure
 	}
+	if count < 1 {
+		l.WithField("count", count).Error("Invalid requested count")
+		return ErrInvalidCount
+	}
+	tags, err := models.ParseTags(c.QueryParam("tags"))
+	if err != nil {
+		l.WithError(err).Error("Failed to parse requested tags")
+		return ErrInvalidTags
+	}
 	l = l.WithFields(map[string]interface{}{
-		"app_id": appID, "action": action, "count": count})
+		"app_id": appID, "action": action, "count": count, "tags": tags.String()})
+
+	// Retrieve the App to determine its bucket resolution
+	app, err := s.requestApp(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return ErrAppRetrievalFailure
+	}
+
+	// Parse the time the action occurred if one was passed
+	var requested time.Time
+	if value := c.QueryParam("timestamp"); value != "" {
+		if requested, err = parseTime(value); err != nil {
+			l.WithError(err).Error("Failed to parse requested timestamp")
+			return ErrParseTimeFailure
+		}
+	}
+	timestamp, err := s.eventTime(app, requested, time.Now())
+	if err != nil {
+		l.WithError(err).WithField("timestamp", requested).Error("Invalid action timestamp")
+		return err
+	}
 
 	// Store the new action in the database
 	l.Debug("Incrementing Action count in DB")
-	if err := s.incrementAction(appID, action, count); err != nil {
+	if err := s.incrementAction(app, action, tags, count, timestamp); err != nil {
 		l.WithError(err).Error("Failed to increment Action count")
 		return ErrIncrementFailure
 	}
+	s.backfillRollups(app.bucket(timestamp))
 
 	// Report the successful create-action to ourselves
 	go client.CreateAction("create-action")
@@ -70,7 +106,9 @@ func (s *Service) CreateAction(c echo.Context) error {
 // ActionCount retrieves the count of actions for an app in the
 // passed duration. Duration should match the same formatting as
 // https://golang.org/pkg/time/#ParseDuration
-// Endpoint: /action/:app_id/action/:action/count/:duration
+// Only actions with all the passed tags are counted and if group_by
+// is passed a count is returned for every value of that tag key
+// Endpoint: /action/:app_id/action/:action/count/:duration?tags=:tags&group_by=:group_by
 func (s *Service) ActionCount(c echo.Context) error {
 	l := s.logger.WithField("method", "action_count")
 	l.Debug("Received new ActionCount request")
@@ -79,8 +117,13 @@ func (s *Service) ActionCount(c echo.Context) error {
 	appID := c.Param("app_id")
 	action := c.Param("action")
 	duration := c.Param("duration")
-	l = l.WithFields(map[string]interface{}{
-		"app_id": appID, "action": action, "duration": duration})
+	tags, groupBy, err := parseTagQuery(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to parse requested tags")
+		return err
+	}
+	l = l.WithFields(map[string]interface{}{"app_id": appID, "action": action,
+		"duration": duration, "tags": tags.String(), "group_by": groupBy})
 
 	// Parse the duration passed
 	l.Debug("Parsing the requested duration")
@@ -90,13 +133,34 @@ func (s *Service) ActionCount(c echo.Context) error {
 		return ErrParseDurationFailure
 	}
 
+	// Retrieve the App to determine its bucket resolution
+	app, err := s.requestApp(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return ErrAppRetrievalFailure
+	}
+
 	now := time.Now() // Get the current time for calculating in actionSum
+	filter := ActionFilter{AppID: appID, Action: action, Tags: tags}
+
+	// Retrieve the grouped action counts from the DB and return
+	if groupBy != "" {
+		l.Debug("Retrieve the grouped counts of Actions from the DB")
+		var counts map[string]int64
+		if err := s.timedGroupedActionSum(&counts, app, filter,
+			now.Add(-1*dur), groupBy); err != nil {
+			l.WithError(err).Error("Failed to retrieve grouped Action sums")
+			return ErrCountSumFailure
+		}
+		go client.CreateAction("action-count")
+		return c.JSON(http.StatusOK, counts)
+	}
 
 	// Retrieve the action count from the DB and return
 	l.Debug("Retrieve the count of Actions from the DB")
 	var count int64
-	if err := s.timedActionSum(&count, appID,
-		action, now.Add(-1*dur)); err != nil {
+	if err := s.timedActionSum(&count, app,
+		filter, now.Add(-1*dur)); err != nil {
 		l.WithError(err).Error("Failed to retrieve Action sum")
 		return ErrCountSumFailure
 	}
@@ -109,10 +173,86 @@ func (s *Service) ActionCount(c echo.Context) error {
 	return c.JSON(http.StatusOK, count)
 }
 
+// ActionRangeCount retrieves the count of actions for an app between
+// two absolute times. Times should be formatted as RFC3339 or unix
+// seconds, from is inclusive, to is exclusive and defaults to now.
+// Tags and group_by behave the same as in ActionCount
+// Endpoint: /action/:app_id/action/:action/range?from=:from&to=:to&tags=:tags&group_by=:group_by
+func (s *Service) ActionRangeCount(c echo.Context) error {
+	l := s.logger.WithField("method", "action_range_count")
+	l.Debug("Received new ActionRangeCount request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	action := c.Param("action")
+	tags, groupBy, err := parseTagQuery(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to parse requested tags")
+		return err
+	}
+	l = l.WithFields(map[string]interface{}{"app_id": appID,
+		"action": action, "tags": tags.String(), "group_by": groupBy})
+
+	// Parse the requested time range
+	l.Debug("Parsing the requested time range")
+	from, to, err := parseTimeRange(c, nil)
+	if err != nil {
+		l.WithError(err).Error("Failed to parse time range")
+		return err
+	}
+	l = l.WithFields(map[string]interface{}{"from": from, "to": to})
+
+	// Retrieve the App to determine its bucket resolution
+	app, err := s.requestApp(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return ErrAppRetrievalFailure
+	}
+
+	filter := ActionFilter{AppID: appID, Action: action,
+		Start: s.bucketStart(app, from), End: to, Tags: tags}
+
+	// Retrieve the grouped action counts from the DB and return
+	if groupBy != "" {
+		l.Debug("Retrieve the grouped counts of Actions from the DB")
+		var counts map[string]int64
+		if err := s.groupedActionSum(&counts, filter, groupBy); err != nil {
+			l.WithError(err).Error("Failed to retrieve grouped Action sums")
+			return ErrCountSumFailure
+		}
+		go client.CreateAction("action-range-count")
+		return c.JSON(http.StatusOK, counts)
+	}
+
+	// Retrieve the action count from the DB and return
+	l.Debug("Retrieve the count of Actions from the DB")
+	var count int64
+	if err := s.actionSum(&count, filter); err != nil {
+		l.WithError(err).Error("Failed to retrieve Action sum")
+		return ErrCountSumFailure
+	}
+
+	// Report the successful action-range-count to ourselves
+	go client.CreateAction("action-range-count")
+
+	// Return an Status OK
+	l.Debug("Returning successful ActionRangeCount response")
+	return c.JSON(http.StatusOK, count)
+}
+
 // ActionSummary retrieves all most recent counts of actions for an app and
-// organizes it into a summary. Duration should match the same formatting as
-// https://golang.org/pkg/time/#ParseDuration
-// Endpoint: /action/:app_id/action/:action/summary
+// organizes it into a summary. By default every window is rolling and
+// ends now. If calendar=true is passed every window is aligned to the
+// start of the current hour, day, week, month and year in the IANA
+// timezone passed as tz (defaults to UTC). If compare=true is passed
+// every window also contains the count of the window preceding it and
+// the absolute and percentage change between them. Tags and group_by
+// behave the same as in ActionCount, except group_by can't be combined
+// with compare. If windows is passed (ex: 15m,1h,6h,24h,30d) a rolling
+// count is returned for every window instead of the fixed summary
+// windows, keyed by the window as it was passed. Windows can only be
+// combined with tags
+// Endpoint: /action/:app_id/action/:action/count?calendar=:calendar&tz=:tz&compare=:compare&windows=:windows&tags=:tags&group_by=:group_by
 func (s *Service) ActionSummary(c echo.Context) error {
 	l := s.logger.WithField("method", "action_summary")
 	l.Debug("Received new ActionSummary request")
@@ -120,19 +260,104 @@ func (s *Service) ActionSummary(c echo.Context) error {
 	// Decode the request variables
 	appID := c.Param("app_id")
 	action := c.Param("action")
-	l = l.WithFields(map[string]interface{}{
-		"app_id": appID, "action": action})
+	calendar, _ := strconv.ParseBool(c.QueryParam("calendar"))
+	compare, _ := strconv.ParseBool(c.QueryParam("compare"))
+	tz := c.QueryParam("tz")
+	tags, groupBy, err := parseTagQuery(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to parse requested tags")
+		return err
+	}
+	l = l.WithFields(map[string]interface{}{"app_id": appID, "action": action, "calendar": calendar,
+		"compare": compare, "tz": tz, "tags": tags.String(), "group_by": groupBy})
+	if compare && groupBy != "" {
+		l.Error("Compared summary requested with group_by")
+		return ErrCompareGroupBy
+	}
+
+	// Parse the requested summary windows if any were passed
+	var names []string
+	var durations []time.Duration
+	if value := c.QueryParam("windows"); value != "" {
+		l = l.WithField("windows", value)
+		if calendar || compare || groupBy != "" {
+			l.Error("Summary windows requested with another summary option")
+			return ErrWindowsCombined
+		}
+		if names, durations, err = parseSummaryWindows(value); err != nil {
+			l.WithError(err).Error("Failed to parse summary windows")
+			return err
+		}
+	}
+
+	// Retrieve the App to determine its bucket resolution
+	app, err := s.requestApp(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return ErrAppRetrievalFailure
+	}
 
 	now := time.Now() // Get the current time for calculating in actionSum
 
+	// Determine the start of every summary window and the window preceding it
+	starts, previous := rollingSummaryStarts(now), previousRollingSummaryStarts(now)
+	if calendar {
+		l.Debug("Loading the requested timezone")
+		var loc *time.Location
+		loc, err = time.LoadLocation(tz)
+		if err != nil {
+			l.WithError(err).Error("Failed to load timezone")
+			return ErrInvalidTimezone
+		}
+		starts, previous = calendarSummaryStarts(now.In(loc)), previousCalendarSummaryStarts(now.In(loc))
+	}
+
+	filter := ActionFilter{AppID: appID, Action: action, Tags: tags}
+
+	// Retrieve a summary for every value of the group_by tag and return
+	if groupBy != "" {
+		l.Debug("Retrieving grouped action sums")
+		summaries, err := s.groupedSummary(app, filter, starts, groupBy)
+		if err != nil {
+			l.WithError(err).Error("Failed to retrieve grouped action sums")
+			return ErrCountSumFailure
+		}
+		go client.CreateAction("action-summary")
+		return c.JSON(http.StatusOK, summaries)
+	}
+
+	// Retrieve the count of every requested window and return
+	if len(durations) > 0 {
+		l.Debug("Retrieving windowed action sums")
+		summary, err := s.windowedSummary(app, filter, now, names, durations)
+		if err != nil {
+			l.WithError(err).Error("Failed to retrieve windowed action sums")
+			return ErrCountSumFailure
+		}
+		go client.CreateAction("action-summary")
+		return c.JSON(http.StatusOK, summary)
+	}
+
+	// Retrieve a comparison of every window to the one preceding it and return
+	if compare {
+		l.Debug("Retrieving compared action sums")
+		comparison, err := s.comparedSummary(app, filter, now, starts, previous)
+		if err != nil {
+			l.WithError(err).Error("Failed to retrieve compared action sums")
+			return ErrCountSumFailure
+		}
+		go client.CreateAction("action-summary")
+		return c.JSON(http.StatusOK, comparison)
+	}
+
 	// Retrieve all count values and place them on the ActionSummary
 	var g errgroup.Group
 	var as models.ActionSummary
-	g.Go(func() error { return s.timedActionSum(&as.Hour, appID, action, now.Add(-1*time.Hour)) })
-	g.Go(func() error { return s.timedActionSum(&as.Day, appID, action, now.Add(-1*time.Hour*24)) })
-	g.Go(func() error { return s.timedActionSum(&as.Week, appID, action, now.Add(-1*time.Hour*24*7)) })
-	g.Go(func() error { return s.timedActionSum(&as.Month, appID, action, now.Add(-1*time.Hour*24*7*30)) })
-	g.Go(func() error { return s.timedActionSum(&as.Year, appID, action, now.Add(-1*time.Hour*24*7*365)) })
+	g.Go(func() error { return s.timedActionSum(&as.Hour, app, filter, starts.Hour) })
+	g.Go(func() error { return s.timedActionSum(&as.Day, app, filter, starts.Day) })
+	g.Go(func() error { return s.timedActionSum(&as.Week, app, filter, starts.Week) })
+	g.Go(func() error { return s.timedActionSum(&as.Month, app, filter, starts.Month) })
+	g.Go(func() error { return s.timedActionSum(&as.Year, app, filter, starts.Year) })
 	if err := g.Wait(); err != nil {
 		l.WithError(err).Error("Failed to retrieve action sums")
 		return ErrCountSumFailure
@@ -146,58 +371,74 @@ func (s *Service) ActionSummary(c echo.Context) error {
 	return c.JSON(http.StatusOK, as)
 }
 
+// summaryStarts contains the start time of every ActionSummary window
+type summaryStarts struct{ Hour, Day, Week, Month, Year time.Time }
+
+// rollingSummaryStarts returns the start of every ActionSummary
+// window when each of them is a fixed duration ending now
+func rollingSummaryStarts(now time.Time) summaryStarts {
+	return summaryStarts{
+		Hour:  now.Add(-1 * time.Hour),
+		Day:   now.Add(-1 * time.Hour * 24),
+		Week:  now.Add(-1 * time.Hour * 24 * 7),
+		Month: now.Add(-1 * time.Hour * 24 * 30),
+		Year:  now.Add(-1 * time.Hour * 24 * 365),
+	}
+}
+
+// calendarSummaryStarts returns the start of the current hour, day,
+// week (beginning Monday), month and year in the location of now
+func calendarSummaryStarts(now time.Time) summaryStarts {
+	y, m, d := now.Date()
+	loc := now.Location()
+	daysSinceMonday := (int(now.Weekday()) + 6) % 7
+	return summaryStarts{
+		Hour:  time.Date(y, m, d, now.Hour(), 0, 0, 0, loc),
+		Day:   time.Date(y, m, d, 0, 0, 0, 0, loc),
+		Week:  time.Date(y, m, d-daysSinceMonday, 0, 0, 0, 0, loc),
+		Month: time.Date(y, m, 1, 0, 0, 0, 0, loc),
+		Year:  time.Date(y, time.January, 1, 0, 0, 0, 0, loc),
+	}
+}
+
 // incrementAction will attempt to increment the count value
-// for an existing Action record for the day. If one doesn't exist
-// a new one will be created with with a count of 1
-func (s *Service) incrementAction(appID, action string, count int) error {
-	// Get the current day and use it as a timestamp
-	now := time.Now()
-	today := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, time.Local)
-
-	// Generate a key and execute the increment query
-	key := generateKey(appID, action, today)
-	return s.db.Exec(`INSERT INTO actions(id, app_id, action, count, timestamp) VALUES(?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE count = count + ?`,
-		key, appID, action, count, today, count).Error
+// for an existing Action record in the Apps bucket containing the
+// passed time. If one doesn't exist a new one will be created with
+// with the passed count. Buckets are always aligned in UTC so results
+// don't depend on the servers TZ
+func (s *Service) incrementAction(app *App, action string, tags models.Tags, count int, timestamp time.Time) error {
+	return s.store.IncrementAction(app.ID, action, tags, count, app.bucket(timestamp))
 }
 
 // generateKey generates and returns a unique, deterministic key
-// for an action
-func generateKey(appID, action string, timestamp time.Time) string {
+// for an action. Tags are only part of the key when present, so an
+// untagged action is keyed by its app, action and bucket timestamp alone.
+// Buckets stored before they were aligned to UTC were keyed by local
+// timestamps (see "Upgrading from local time buckets" in the README)
+func generateKey(appID, action, tags string, timestamp time.Time) string {
 	keySlice := []string{appID, action, timestamp.String()}
+	if tags != "" {
+		keySlice = append(keySlice, tags)
+	}
 	keyStr := strings.Join(keySlice, "_")
 	return fmt.Sprintf("%x", md5.Sum([]byte(keyStr)))
 }
 
-// SumResult represents a sum query result
-type SumResult struct{ Total int64 }
-
 // timedActionSum returns a sum specifically tailored to the
-// requested app, action and only occuring after the passed time
-func (s *Service) timedActionSum(out *int64, appID, action string, startTime time.Time) error {
-	return s.actionSum(out, "app_id = ?", appID, "action = ?", action, "timestamp > ?", startTime)
+// requested filter and only occuring in or after the bucket
+// containing the passed time
+func (s *Service) timedActionSum(out *int64, app *App, filter ActionFilter, startTime time.Time) error {
+	filter.Start = s.bucketStart(app, startTime)
+	return s.actionSum(out, filter)
 }
 
-// actionSum will attempt to retrieve all actions and
-// SUM them all to retrieve the total number of actions
-func (s *Service) actionSum(out *int64, where ...interface{}) error {
-	// Begin query for action sum
-	query := s.db.Model(&Action{}).Select("sum(count) as total")
-
-	// Verify there's an even number of where arguments
-	if len(where)%2 != 0 {
-		return errors.New("Non-even where passed")
-	}
-
-	// Apply all passed where filters
-	for i := 0; i <= len(where)-1; i = i + 2 {
-		query = query.Where(where[i], where[i+1])
-	}
-
-	// Scan result and return
-	var res SumResult
-	if err := query.Scan(&res).Error; err != nil {
+// actionSum will attempt to retrieve all actions matching the
+// filter and SUM them all to retrieve the total number of actions
+func (s *Service) actionSum(out *int64, filter ActionFilter) error {
+	total, err := s.store.SumActions(filter)
+	if err != nil {
 		return err
 	}
-	*out = res.Total
+	*out = total
 	return nil
 }
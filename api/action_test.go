@@ -0,0 +1,235 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+func TestCreateAction(t *testing.T) {
+	_, e := newTestService(t)
+	app := createTestApp(t, e, "")
+
+	// Create tagged and untagged actions
+	for _, path := range []string{
+		"/v1/app/%s/action/signup/create/3?tags=platform:ios",
+		"/v1/app/%s/action/signup/create/2?tags=platform:android,country:us",
+		"/v1/app/%s/action/signup/create/1",
+	} {
+		if code := testRequest(t, e, http.MethodPost, fmt.Sprintf(path, app.ID),
+			app.Token, nil, nil); code != http.StatusOK {
+			t.Fatalf("Expected POST %s to return 200, got %d", path, code)
+		}
+	}
+
+	// Every action is counted unless filtered by tags
+	countPath := fmt.Sprintf("/v1/app/%s/action/signup/count/1h", app.ID)
+	if count := testCount(t, e, countPath, ""); count != 6 {
+		t.Errorf("Expected a count of 6, got %d", count)
+	}
+	if count := testCount(t, e, countPath+"?tags=platform:android", ""); count != 2 {
+		t.Errorf("Expected a count of 2 with platform:android, got %d", count)
+	}
+
+	// Grouped counts include actions without the key under ""
+	var grouped map[string]int64
+	if code := testRequest(t, e, http.MethodGet, countPath+"?group_by=platform",
+		"", nil, &grouped); code != http.StatusOK {
+		t.Fatalf("Expected a grouped count to return 200, got %d", code)
+	}
+	expected := map[string]int64{"ios": 3, "android": 2, "": 1}
+	for value, count := range expected {
+		if grouped[value] != count {
+			t.Errorf("Expected a count of %d for platform %q, got %d", count, value, grouped[value])
+		}
+	}
+}
+
+func TestCreateActionInvalid(t *testing.T) {
+	_, e := newTestService(t)
+	app := createTestApp(t, e, "")
+
+	future := time.Now().Add(time.Hour).Unix()
+	for _, path := range []string{
+		"/v1/app/%s/action/signup/create/many",
+		"/v1/app/%s/action/signup/create/1?tags=platform",
+		fmt.Sprintf("/v1/app/%%s/action/signup/create/1?timestamp=%d", future),
+	} {
+		if code := testRequest(t, e, http.MethodPost, fmt.Sprintf(path, app.ID),
+			app.Token, nil, nil); code != http.StatusBadRequest {
+			t.Errorf("Expected POST %s to return 400, got %d", path, code)
+		}
+	}
+}
+
+func TestCreateActionTimestamp(t *testing.T) {
+	_, e := newTestService(t)
+	app := createTestApp(t, e, "")
+
+	// Actions are counted in the bucket of their timestamp
+	hourAgo := time.Now().Add(-90 * time.Minute)
+	path := fmt.Sprintf("/v1/app/%s/action/signup/create/4?timestamp=%d", app.ID, hourAgo.Unix())
+	if code := testRequest(t, e, http.MethodPost, path, app.Token, nil, nil); code != http.StatusOK {
+		t.Fatalf("Expected a backfilled action to return 200, got %d", code)
+	}
+	if count := testCount(t, e, fmt.Sprintf("/v1/app/%s/action/signup/count/1m", app.ID), ""); count != 0 {
+		t.Errorf("Expected a count of 0 in the current bucket, got %d", count)
+	}
+	bucket := hourAgo.UTC().Truncate(time.Hour)
+	rangePath := fmt.Sprintf("/v1/app/%s/action/signup/range?from=%d&to=%d",
+		app.ID, bucket.Unix(), bucket.Add(time.Hour).Unix())
+	if count := testCount(t, e, rangePath, ""); count != 4 {
+		t.Errorf("Expected a count of 4 in the backfilled bucket, got %d", count)
+	}
+}
+
+func TestCreateActions(t *testing.T) {
+	_, e := newTestService(t)
+	app := createTestApp(t, e, "")
+	path := fmt.Sprintf("/v1/app/%s/actions", app.ID)
+	countPath := fmt.Sprintf("/v1/app/%s/action/signup/count/1h", app.ID)
+
+	// Every entry of a valid batch is applied
+	entries := []models.ActionEntry{
+		{Action: "signup", Count: 2},
+		{Action: "signup", Count: 5, Tags: "platform:ios"},
+	}
+	if code := testRequest(t, e, http.MethodPost, path, app.Token, entries, nil); code != http.StatusOK {
+		t.Fatalf("Expected CreateActions to return 200, got %d", code)
+	}
+	if count := testCount(t, e, countPath, ""); count != 7 {
+		t.Errorf("Expected a count of 7, got %d", count)
+	}
+
+	// A batch with invalid entries is rejected as a whole, listing
+	// every invalid entry
+	entries = []models.ActionEntry{
+		{Action: "signup", Count: 2},
+		{Action: "", Count: 1},
+		{Action: "signup", Count: 1, Tags: "not a tag"},
+		{Action: "signup", Count: 1, Timestamp: time.Now().Add(time.Hour)},
+		{Action: "signup", Count: 0},
+		{Action: "signup", Count: -5},
+		{Action: "signup", Count: 5, Tags: "platform:ios"},
+	}
+	var batchErr models.ActionBatchError
+	if code := testBatchRequest(t, e, path, app.Token, entries, &batchErr); code != http.StatusBadRequest {
+		t.Fatalf("Expected CreateActions to return 400, got %d", code)
+	}
+	if len(batchErr.Rejected) != 5 {
+		t.Fatalf("Expected 5 rejected entries, got %+v", batchErr.Rejected)
+	}
+	for i, rejected := range batchErr.Rejected {
+		if rejected.Index != i+1 || rejected.Message == "" {
+			t.Errorf("Expected entry %d to be rejected with a message, got %+v", i+1, rejected)
+		}
+	}
+	if count := testCount(t, e, countPath, ""); count != 7 {
+		t.Errorf("Expected the rejected batch not to be applied, got a count of %d", count)
+	}
+}
+
+func TestCreateActionsSentAt(t *testing.T) {
+	_, e := newTestService(t)
+	app := createTestApp(t, e, "")
+
+	// A client whose clock is ten minutes fast is corrected by sent_at
+	fast := time.Now().Add(10 * time.Minute).UTC()
+	entries := []models.ActionEntry{{Action: "signup", Count: 3, Timestamp: fast}}
+	path := fmt.Sprintf("/v1/app/%s/actions?sent_at=%s", app.ID, fast.Format(time.RFC3339Nano))
+	if code := testRequest(t, e, http.MethodPost, path, app.Token, entries, nil); code != http.StatusOK {
+		t.Fatalf("Expected CreateActions to return 200, got %d", code)
+	}
+	countPath := fmt.Sprintf("/v1/app/%s/action/signup/count/1h", app.ID)
+	if count := testCount(t, e, countPath, ""); count != 3 {
+		t.Errorf("Expected a count of 3, got %d", count)
+	}
+
+	// Without it the same entry is outside of the accepted window
+	path = fmt.Sprintf("/v1/app/%s/actions", app.ID)
+	var batchErr models.ActionBatchError
+	if code := testBatchRequest(t, e, path, app.Token, entries, &batchErr); code != http.StatusBadRequest {
+		t.Fatalf("Expected CreateActions to return 400, got %d", code)
+	}
+	if len(batchErr.Rejected) != 1 || batchErr.Rejected[0].Index != 0 {
+		t.Errorf("Expected the entry to be rejected, got %+v", batchErr.Rejected)
+	}
+}
+
+// testBatchRequest posts a batch of entries to path, decoding a 400
+// response into batchErr. The status code of the response is returned
+func testBatchRequest(t *testing.T, e *echo.Echo, path, token string,
+	entries []models.ActionEntry, batchErr *models.ActionBatchError) int {
+	t.Helper()
+	rec := serveTestRequest(t, e, http.MethodPost, path, token, entries)
+	if rec.Code == http.StatusBadRequest {
+		if err := json.Unmarshal(rec.Body.Bytes(), batchErr); err != nil {
+			t.Fatalf("Failed to decode batch error %q: %v", rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestActionSummaryCalendar(t *testing.T) {
+	_, e := newTestService(t)
+	app := createTestApp(t, e, "")
+
+	// Create actions now and two hours ago
+	for _, path := range []string{
+		"/v1/app/%s/action/signup/create/1",
+		fmt.Sprintf("/v1/app/%%s/action/signup/create/2?timestamp=%d", time.Now().Add(-2*time.Hour).Unix()),
+	} {
+		if code := testRequest(t, e, http.MethodPost, fmt.Sprintf(path, app.ID),
+			app.Token, nil, nil); code != http.StatusOK {
+			t.Fatalf("Expected POST %s to return 200, got %d", path, code)
+		}
+	}
+
+	// Both rolling and calendar hours exclude the older actions
+	path := fmt.Sprintf("/v1/app/%s/action/signup/count", app.ID)
+	for _, query := range []string{"", "?calendar=true&tz=America/New_York"} {
+		var summary models.ActionSummary
+		if code := testRequest(t, e, http.MethodGet, path+query, "", nil, &summary); code != http.StatusOK {
+			t.Fatalf("Expected GET %s to return 200, got %d", path+query, code)
+		}
+		if summary.Hour != 1 {
+			t.Errorf("Expected GET %s to count 1 action in the hour, got %+v", path+query, summary)
+		}
+		if query == "" && summary.Day != 3 {
+			t.Errorf("Expected a rolling day to count 3 actions, got %d", summary.Day)
+		}
+	}
+
+	// Unknown timezones are rejected
+	if code := testRequest(t, e, http.MethodGet, path+"?calendar=true&tz=Mars/Olympus_Mons",
+		"", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown timezone to return 400, got %d", code)
+	}
+}
+
+func TestCalendarSummaryStarts(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Failed to load timezone: %v", err)
+	}
+
+	// Every window starts in the timezone of now and weeks begin Monday
+	now := time.Date(2018, time.January, 3, 15, 30, 0, 0, loc)
+	starts := calendarSummaryStarts(now)
+	for name, test := range map[string]struct{ got, expected time.Time }{
+		"hour":  {starts.Hour, time.Date(2018, time.January, 3, 15, 0, 0, 0, loc)},
+		"day":   {starts.Day, time.Date(2018, time.January, 3, 0, 0, 0, 0, loc)},
+		"week":  {starts.Week, time.Date(2018, time.January, 1, 0, 0, 0, 0, loc)},
+		"month": {starts.Month, time.Date(2018, time.January, 1, 0, 0, 0, 0, loc)},
+		"year":  {starts.Year, time.Date(2018, time.January, 1, 0, 0, 0, 0, loc)},
+	} {
+		if !test.got.Equal(test.expected) {
+			t.Errorf("Expected the %s to start at %s, got %s", name, test.expected, test.got)
+		}
+	}
+}
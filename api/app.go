@@ -18,20 +18,175 @@ var (
 	ErrMaxAppsExceeded = echo.NewHTTPError(http.StatusForbidden, "The maximum Apps for this IP has been exceeded")
 	// ErrAppStoreFailure is thrown when there is an error storing a new App in the DB
 	ErrAppStoreFailure = echo.NewHTTPError(http.StatusInternalServerError, "Failed to store new App in DB")
+	// ErrAppRetrievalFailure is thrown when we fail to retrieve an App
+	ErrAppRetrievalFailure = echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve App")
+	// ErrInvalidRetention is thrown when a retention period can't be parsed
+	ErrInvalidRetention = echo.NewHTTPError(http.StatusBadRequest, "Failed to parse retention days")
+	// ErrInvalidTimestampWindow is thrown when a max skew or backfill can't be parsed
+	ErrInvalidTimestampWindow = echo.NewHTTPError(http.StatusBadRequest, "Failed to parse max skew or backfill duration")
+	// ErrInvalidResolution is thrown when an unknown bucket resolution is requested
+	ErrInvalidResolution = echo.NewHTTPError(http.StatusBadRequest, "Resolution must be one of minute, hour or day")
+	// ErrInvalidAppName is thrown when an App name is empty or too long
+	ErrInvalidAppName = echo.NewHTTPError(http.StatusBadRequest, "App name must be 1 to 100 characters")
+	// ErrParseStrictAuthFailure is thrown when we fail to parse a strict auth value
+	ErrParseStrictAuthFailure = echo.NewHTTPError(http.StatusBadRequest, "Failed to parse strict auth")
+	// ErrAppNotFound is thrown when a requested App doesn't exist
+	ErrAppNotFound = echo.NewHTTPError(http.StatusNotFound, "App not found")
+	// ErrAppUpdateFailure is thrown when we fail to update an App in the DB
+	ErrAppUpdateFailure = echo.NewHTTPError(http.StatusInternalServerError, "Failed to update App in DB")
+	// ErrAppDeleteFailure is thrown when we fail to delete an App from the DB
+	ErrAppDeleteFailure = echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete App from DB")
 )
 
+const (
+	// maxAppNameLength is the maximum length of an App name
+	maxAppNameLength = 100
+	// orphanDeleteDelay is how long after deleting an App its buckets
+	// are deleted again, by when no server still has the App cached
+	orphanDeleteDelay = maxAppCacheExp * 2
+)
+
+// resolutions maps every bucket resolution an App may be created
+// with to the duration of its buckets
+var resolutions = map[string]time.Duration{
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    time.Hour * 24,
+}
+
 // App is an application that we will count actions for
 type App struct {
-	ID         string    `json:"id" gorm:"type:varchar(10);primary_key;unique_index"`
-	Name       string    `json:"name" gorm:"type:varchar(100);not null"`
-	Token      string    `json:"token" gorm:"type:varchar(32);not null"`
-	StrictAuth bool      `json:"strictAuth" gorm:"type:bool;not null"`
-	IP         string    `json:"ip" gorm:"type:varchar(40);index;not null"`
-	CreatedAt  time.Time `json:"createdAt" sql:"index"`
+	ID            string    `json:"id" gorm:"type:varchar(10);primary_key;unique_index"`
+	Name          string    `json:"name" gorm:"type:varchar(100);not null"`
+	Token         string    `json:"token,omitempty" gorm:"type:varchar(32);not null"` // Plaintext, only set when created or inserted by hand
+	StrictAuth    bool      `json:"strictAuth" gorm:"type:bool;not null"`
+	IP            string    `json:"ip" gorm:"type:varchar(40);index;not null"`
+	Resolution    string    `json:"resolution" gorm:"type:varchar(10);not null;default:'hour'"`
+	RetentionDays int       `json:"retentionDays" gorm:"not null;default:0"`
+	MaxSkew       int       `json:"maxSkew" gorm:"not null;default:0"`     // Seconds
+	MaxBackfill   int       `json:"maxBackfill" gorm:"not null;default:0"` // Seconds
+	CreatedAt     time.Time `json:"createdAt" sql:"index"`
+
+	// Tokens are only stored as salted hashes. The previous token
+	// remains valid until PreviousTokenExpiresAt after rotating it
+	TokenSalt              string     `json:"-" gorm:"type:varchar(32);not null;default:''"`
+	TokenHash              string     `json:"-" gorm:"type:varchar(64);not null;default:''"`
+	PreviousTokenHash      string     `json:"-" gorm:"type:varchar(64);not null;default:''"`
+	PreviousTokenExpiresAt *time.Time `json:"previousTokenExpiresAt,omitempty"`
+	// PreviousToken is only set on rows rotated before tokens were
+	// hashed and is cleared by hashLegacyTokens
+	PreviousToken string `json:"-" gorm:"type:varchar(32);not null;default:''"`
+}
+
+// resolution returns the duration of the Apps Action buckets
+func (a *App) resolution() time.Duration {
+	if res, ok := resolutions[a.Resolution]; ok {
+		return res
+	}
+	return time.Hour
+}
+
+// retentionDays returns the number of days the Apps Actions are
+// kept for, falling back to the passed server default
+func (a *App) retentionDays(defaultDays int) int {
+	if a.RetentionDays == 0 {
+		return defaultDays
+	}
+	return a.RetentionDays
+}
+
+// timestampWindow returns how far in the future and past the Apps
+// event timestamps may be, falling back to the passed server defaults
+func (a *App) timestampWindow(defaultSkew, defaultBackfill time.Duration) (time.Duration, time.Duration) {
+	maxSkew, maxBackfill := defaultSkew, defaultBackfill
+	if a.MaxSkew > 0 {
+		maxSkew = time.Duration(a.MaxSkew) * time.Second
+	}
+	if a.MaxBackfill > 0 {
+		maxBackfill = time.Duration(a.MaxBackfill) * time.Second
+	}
+	return maxSkew, maxBackfill
+}
+
+// withoutToken returns a copy of the App that is safe to return from
+// any endpoint other than CreateApp
+func (a *App) withoutToken() *App {
+	app := *a
+	app.Token = ""
+	app.PreviousToken = ""
+	return &app
+}
+
+// setToken stores a salted hash of the passed token as the Apps
+// current token, generating the Apps salt if it doesn't have one
+func (a *App) setToken(token string) {
+	if a.TokenSalt == "" {
+		a.TokenSalt = newUUID()
+	}
+	a.Token = ""
+	a.TokenHash = hashToken(a.TokenSalt, token)
+}
+
+// hashLegacyTokens replaces any plaintext tokens of the App with
+// salted hashes, reporting whether any were found
+func (a *App) hashLegacyTokens() bool {
+	if a.Token == "" && a.PreviousToken == "" {
+		return false
+	}
+	if a.TokenSalt == "" {
+		a.TokenSalt = newUUID()
+	}
+	if a.Token != "" {
+		a.setToken(a.Token)
+	}
+	if a.PreviousToken != "" {
+		a.PreviousTokenHash = hashToken(a.TokenSalt, a.PreviousToken)
+		a.PreviousToken = ""
+	}
+	return true
+}
+
+// currentToken reports whether the passed token is the Apps current
+// token. Apps inserted by hand are compared in plaintext until their
+// tokens are hashed the next time the server starts
+func (a *App) currentToken(token string) bool {
+	if a.Token != "" {
+		return equalTokens(token, a.Token)
+	}
+	return a.TokenHash != "" && equalTokens(hashToken(a.TokenSalt, token), a.TokenHash)
+}
+
+// validToken reports whether the passed token is the Apps current
+// token, or its previous token within the grace period it was given
+// when the token was rotated
+func (a *App) validToken(token string, now time.Time) bool {
+	if a.currentToken(token) {
+		return true
+	}
+	if a.PreviousTokenExpiresAt == nil || !now.Before(*a.PreviousTokenExpiresAt) {
+		return false
+	}
+	if a.PreviousToken != "" {
+		return equalTokens(token, a.PreviousToken)
+	}
+	return a.PreviousTokenHash != "" && equalTokens(hashToken(a.TokenSalt, token), a.PreviousTokenHash)
 }
 
-// CreateApp creates a new application and stores it in the database
-// Endpoint: /app/create/:name
+// bucket returns the start of the Action bucket the passed
+// time occurs in. Buckets are always aligned in UTC
+func (a *App) bucket(t time.Time) time.Time {
+	return t.UTC().Truncate(a.resolution())
+}
+
+// CreateApp creates a new application and stores it in the database.
+// Resolution is the size of the Apps Action buckets (minute, hour or
+// day) and defaults to hour. It can't be changed after creation.
+// Retention days is the number of days Actions are kept for, 0 uses
+// the server default and a negative value keeps Actions forever.
+// Max skew and max backfill are durations limiting how far in the
+// future and past submitted timestamps may be, defaulting to the
+// server defaults
+// Endpoint: /app/create/:name?strict_auth=:strict_auth&resolution=:resolution&retention_days=:retention_days&max_skew=:max_skew&max_backfill=:max_backfill
 func (s *Service) CreateApp(c echo.Context) error {
 	l := s.logger.WithField("method", "create_app")
 	l.Debug("Received new CreateApp request")
@@ -40,15 +195,52 @@ func (s *Service) CreateApp(c echo.Context) error {
 	ip := c.RealIP()
 	name := c.Param("name")
 	strictAuth, _ := strconv.ParseBool(c.QueryParam("strict_auth"))
+	resolution := c.QueryParam("resolution")
+	if resolution == "" {
+		resolution = "hour"
+	}
 	l = l.WithFields(map[string]interface{}{
-		"name": name, "strict_auth": strictAuth})
+		"name": name, "strict_auth": strictAuth, "resolution": resolution})
+
+	// Verify the requested name
+	if !validAppName(name) {
+		l.Error("Invalid App name requested")
+		return ErrInvalidAppName
+	}
+
+	// Parse the retention period if one was passed
+	var retentionDays int
+	if value := c.QueryParam("retention_days"); value != "" {
+		var err error
+		if retentionDays, err = strconv.Atoi(value); err != nil {
+			l.WithError(err).Error("Failed to parse retention days")
+			return ErrInvalidRetention
+		}
+	}
+
+	// Parse the accepted timestamp window if one was passed
+	maxSkew, err := parseWindow(c.QueryParam("max_skew"))
+	if err != nil {
+		l.WithError(err).Error("Failed to parse max skew")
+		return ErrInvalidTimestampWindow
+	}
+	maxBackfill, err := parseWindow(c.QueryParam("max_backfill"))
+	if err != nil {
+		l.WithError(err).Error("Failed to parse max backfill")
+		return ErrInvalidTimestampWindow
+	}
+
+	// Verify the requested bucket resolution
+	if _, ok := resolutions[resolution]; !ok {
+		l.Error("Invalid resolution requested")
+		return ErrInvalidResolution
+	}
 
 	// Generates an AppID UUID and a Token UUID
 	l.Debug("Generating new App UUIDs")
 	appID := newAppID()
 	token := newUUID()
-	l = l.WithFields(map[string]interface{}{
-		"app_id": appID, "token": token})
+	l = l.WithField("app_id", appID)
 
 	// Check if maximum apps has been exceeded
 	l.Debug("Verifying the IP hasn't exceeded max Apps")
@@ -64,38 +256,254 @@ func (s *Service) CreateApp(c echo.Context) error {
 	// Create a new App from the generated UUIDs
 	l.Debug("Generating new App")
 	newApp := &App{
-		ID:         appID,
-		Name:       name,
-		Token:      token,
-		IP:         ip,
-		StrictAuth: strictAuth,
-		CreatedAt:  time.Now(), // Use the servers current time
+		ID:            appID,
+		Name:          name,
+		IP:            ip,
+		StrictAuth:    strictAuth,
+		Resolution:    resolution,
+		RetentionDays: retentionDays,
+		MaxSkew:       maxSkew,
+		MaxBackfill:   maxBackfill,
+		CreatedAt:     time.Now(), // Use the servers current time
 	}
+	newApp.setToken(token)
 
 	// Insert the new App in the DB
 	l.Debug("Storing new App in DB")
-	if err := s.db.Create(newApp).Error; err != nil {
+	if err := s.store.CreateApp(newApp); err != nil {
 		l.WithError(err).Error("Failed to create new App in DB")
 		return ErrAppStoreFailure
 	}
 
 	// Cache the app for future actions
 	l.Debug("Storing App in Cache")
-	s.cache.SetDefault(appID, newApp)
+	s.cacheApp(newApp)
 
 	// Report the successful create-app to ourselves
 	go client.CreateAction("create-app")
 
-	// Return the newly generated App
+	// Return the newly generated App along with its token. This is the
+	// only time the token is ever returned
 	l.Debug("Returning newly generated/stored App")
-	return c.JSON(http.StatusOK, newApp)
+	created := *newApp
+	created.Token = token
+	return c.JSON(http.StatusOK, &created)
+}
+
+// GetApp retrieves an App. The Apps token is never returned
+// Endpoint: /app/:app_id
+func (s *Service) GetApp(c echo.Context) error {
+	l := s.logger.WithField("method", "get_app")
+	l.Debug("Received new GetApp request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	l = l.WithField("app_id", appID)
+
+	// Retrieve the App from the DB
+	l.Debug("Retrieving App from DB")
+	app, err := s.managedApp(appID)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return err
+	}
+
+	// Report the successful get-app to ourselves
+	go client.CreateAction("get-app")
+
+	// Return the App without its token
+	l.Debug("Returning successful GetApp response")
+	return c.JSON(http.StatusOK, app.withoutToken())
+}
+
+// RenameApp changes the name of an App
+// Endpoint: /app/:app_id/rename/:name
+func (s *Service) RenameApp(c echo.Context) error {
+	l := s.logger.WithField("method", "rename_app")
+	l.Debug("Received new RenameApp request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	name := c.Param("name")
+	l = l.WithFields(map[string]interface{}{"app_id": appID, "name": name})
+
+	// Verify the requested name
+	if !validAppName(name) {
+		l.Error("Invalid App name requested")
+		return ErrInvalidAppName
+	}
+
+	// Rename the App and store it
+	l.Debug("Renaming App")
+	app, err := s.updateApp(appID, func(app *App) { app.Name = name })
+	if err != nil {
+		l.WithError(err).Error("Failed to rename App")
+		return err
+	}
+
+	// Report the successful rename-app to ourselves
+	go client.CreateAction("rename-app")
+
+	// Return the updated App without its token
+	l.Debug("Returning successful RenameApp response")
+	return c.JSON(http.StatusOK, app.withoutToken())
+}
+
+// SetStrictAuth sets whether every request of an App, rather than
+// only POST requests, must be authenticated
+// Endpoint: /app/:app_id/strict_auth/:strict_auth
+func (s *Service) SetStrictAuth(c echo.Context) error {
+	l := s.logger.WithField("method", "set_strict_auth")
+	l.Debug("Received new SetStrictAuth request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	strictAuth, err := strconv.ParseBool(c.Param("strict_auth"))
+	if err != nil {
+		l.WithError(err).Error("Failed to parse strict auth")
+		return ErrParseStrictAuthFailure
+	}
+	l = l.WithFields(map[string]interface{}{"app_id": appID, "strict_auth": strictAuth})
+
+	// Update the App and store it
+	l.Debug("Updating App strict auth")
+	app, err := s.updateApp(appID, func(app *App) { app.StrictAuth = strictAuth })
+	if err != nil {
+		l.WithError(err).Error("Failed to update App strict auth")
+		return err
+	}
+
+	// Report the successful set-strict-auth to ourselves
+	go client.CreateAction("set-strict-auth")
+
+	// Return the updated App without its token
+	l.Debug("Returning successful SetStrictAuth response")
+	return c.JSON(http.StatusOK, app.withoutToken())
+}
+
+// DeleteApp deletes an App along with every bucket of every metric
+// type stored for it
+// Endpoint: /app/:app_id
+func (s *Service) DeleteApp(c echo.Context) error {
+	l := s.logger.WithField("method", "delete_app")
+	l.Debug("Received new DeleteApp request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	l = l.WithField("app_id", appID)
+
+	// Verify the App exists
+	l.Debug("Retrieving App from DB")
+	if _, err := s.managedApp(appID); err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return err
+	}
+
+	// Retrieve the Apps Keys so they can be removed from the cache
+	l.Debug("Retrieving Keys from DB")
+	keys, err := s.store.ListKeys(appID)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve Keys")
+		return ErrAppDeleteFailure
+	}
+
+	// Delete the App and all of its buckets from the DB
+	l.Debug("Deleting App from DB")
+	if err := s.store.DeleteApp(appID); err != nil {
+		l.WithError(err).Error("Failed to delete App from DB")
+		return ErrAppDeleteFailure
+	}
+
+	// Remove the App and its Keys from the cache so they can't be
+	// used again
+	l.Debug("Removing App from Cache")
+	s.cache.Delete(appID)
+	for _, key := range keys {
+		s.cache.Delete(keyCacheKey(key.ID))
+	}
+
+	// Other servers may still serve the App from their cache, so
+	// delete any buckets they create once every cached App expired
+	go s.deleteAppAfter(appID, orphanDeleteDelay)
+
+	// Report the successful delete-app to ourselves
+	go client.CreateAction("delete-app")
+
+	// Return an Status OK
+	l.Debug("Returning successful DeleteApp response")
+	return c.NoContent(http.StatusOK)
+}
+
+// deleteAppAfter deletes an App and all of its buckets from the DB
+// again after the passed delay unless the Service is closed first
+func (s *Service) deleteAppAfter(appID string, delay time.Duration) {
+	l := s.logger.WithFields(map[string]interface{}{
+		"method": "delete_app_after", "app_id": appID})
+
+	select {
+	case <-s.done:
+		return
+	case <-time.After(delay):
+	}
+	l.Debug("Deleting App buckets created after deletion")
+	if err := s.store.DeleteApp(appID); err != nil {
+		l.WithError(err).Error("Failed to delete App buckets")
+	}
+}
+
+// managedApp retrieves an App from the DB, bypassing the cache so
+// management endpoints always see the stored App
+func (s *Service) managedApp(appID string) (*App, error) {
+	app, err := s.store.GetApp(appID)
+	if err == ErrNotFound {
+		return nil, ErrAppNotFound
+	}
+	if err != nil {
+		return nil, ErrAppRetrievalFailure
+	}
+	return app, nil
+}
+
+// updateApp applies the passed update to the stored App and replaces
+// the cached App with the updated one
+func (s *Service) updateApp(appID string, update func(app *App)) (*App, error) {
+	app, err := s.managedApp(appID)
+	if err != nil {
+		return nil, err
+	}
+	update(app)
+	if err := s.store.UpdateApp(app); err != nil {
+		return nil, ErrAppUpdateFailure
+	}
+	s.cacheApp(app)
+	return app, nil
+}
+
+// validAppName reports whether the passed name may be used for an App
+func validAppName(name string) bool {
+	return name != "" && len(name) <= maxAppNameLength
+}
+
+// parseWindow parses an optional non-negative duration into whole
+// seconds, returning 0 if it wasn't passed
+func parseWindow(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	dur, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if dur < 0 {
+		return 0, ErrInvalidTimestampWindow
+	}
+	return int(dur / time.Second), nil
 }
 
 // currentApps returns the number of apps an IP has created
 func (s *Service) currentApps(ip string) (int, error) {
-	var count int
-	return count, s.db.Model(&App{}).
-		Where(&App{IP: ip}).Count(&count).Error
+	count, err := s.store.CountApps(ip)
+	return int(count), err
 }
 
 // newAppID generates the first part of a new V4 UUID
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+func TestManageApp(t *testing.T) {
+	_, e := newTestService(t)
+	app := createTestApp(t, e, "")
+	path := fmt.Sprintf("/v1/app/%s", app.ID)
+
+	// Apps are retrieved by ID
+	var retrieved App
+	if code := testRequest(t, e, http.MethodGet, path, testAdminToken, nil, &retrieved); code != http.StatusOK {
+		t.Fatalf("Expected GetApp to return 200, got %d", code)
+	}
+	if retrieved.ID != app.ID || retrieved.Name != "test" {
+		t.Errorf("Expected the created App, got %+v", retrieved)
+	}
+	if code := testRequest(t, e, http.MethodGet, "/v1/app/missing", testAdminToken,
+		nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected GetApp of a missing App to return 404, got %d", code)
+	}
+
+	// Apps are renamed to valid names only
+	var renamed App
+	if code := testRequest(t, e, http.MethodPost, path+"/rename/renamed", testAdminToken,
+		nil, &renamed); code != http.StatusOK {
+		t.Fatalf("Expected RenameApp to return 200, got %d", code)
+	}
+	if renamed.Name != "renamed" || renamed.Token != "" {
+		t.Errorf("Expected the renamed App without its token, got %+v", renamed)
+	}
+	longName := strings.Repeat("a", maxAppNameLength+1)
+	if code := testRequest(t, e, http.MethodPost, path+"/rename/"+longName, testAdminToken,
+		nil, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected RenameApp with a long name to return 400, got %d", code)
+	}
+
+	// Strict auth applies to reads as soon as it's set
+	countPath := fmt.Sprintf("/v1/app/%s/action/signup/count/1h", app.ID)
+	for _, test := range []struct {
+		strictAuth string
+		code       int
+	}{
+		{"true", http.StatusUnauthorized},
+		{"false", http.StatusOK},
+	} {
+		var updated App
+		if code := testRequest(t, e, http.MethodPost, path+"/strict_auth/"+test.strictAuth,
+			testAdminToken, nil, &updated); code != http.StatusOK {
+			t.Fatalf("Expected SetStrictAuth to return 200, got %d", code)
+		}
+		if fmt.Sprint(updated.StrictAuth) != test.strictAuth {
+			t.Errorf("Expected StrictAuth to be %s, got %t", test.strictAuth, updated.StrictAuth)
+		}
+		if code := testRequest(t, e, http.MethodGet, countPath, "", nil, nil); code != test.code {
+			t.Errorf("Expected an unauthenticated read with StrictAuth %s to return %d, got %d",
+				test.strictAuth, test.code, code)
+		}
+	}
+	if code := testRequest(t, e, http.MethodPost, path+"/strict_auth/maybe", testAdminToken,
+		nil, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected SetStrictAuth with an invalid value to return 400, got %d", code)
+	}
+}
+
+func TestDeleteApp(t *testing.T) {
+	s, e := newTestService(t)
+	app := createTestApp(t, e, "")
+	path := fmt.Sprintf("/v1/app/%s", app.ID)
+	createPath := fmt.Sprintf("/v1/app/%s/action/signup/create/1", app.ID)
+
+	// Use a Key so it's cached along with the App
+	var key models.Key
+	keyPath := fmt.Sprintf("/v1/app/%s/keys/create/ingest?scopes=ingest", app.ID)
+	if code := testRequest(t, e, http.MethodPost, keyPath, app.Token, nil, &key); code != http.StatusOK {
+		t.Fatalf("Expected CreateKey to return 200, got %d", code)
+	}
+	if code := testRequest(t, e, http.MethodPost, createPath, key.Token, nil, nil); code != http.StatusOK {
+		t.Fatalf("Expected the Key to be valid, got %d", code)
+	}
+
+	// Deleted Apps and their Keys are gone from the DB and cache
+	if code := testRequest(t, e, http.MethodDelete, path, testAdminToken, nil, nil); code != http.StatusOK {
+		t.Fatalf("Expected DeleteApp to return 200, got %d", code)
+	}
+	if code := testRequest(t, e, http.MethodGet, path, testAdminToken, nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected GetApp of a deleted App to return 404, got %d", code)
+	}
+	if _, ok := s.cache.Get(keyCacheKey(key.ID)); ok {
+		t.Error("Expected the deleted Apps Key to be removed from the cache")
+	}
+	for _, token := range []string{app.Token, key.Token} {
+		if code := testRequest(t, e, http.MethodPost, createPath, token, nil, nil); code != http.StatusUnauthorized {
+			t.Errorf("Expected token %q of a deleted App to return 401, got %d", token, code)
+		}
+	}
+	if code := testRequest(t, e, http.MethodDelete, path, testAdminToken, nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected deleting a deleted App to return 404, got %d", code)
+	}
+
+	// Buckets created by servers still caching the App are deleted
+	// once the delay passes
+	if err := s.store.IncrementAction(app.ID, "signup", nil, 1, time.Now()); err != nil {
+		t.Fatalf("Failed to seed Action: %v", err)
+	}
+	s.deleteAppAfter(app.ID, 0)
+	sum, err := s.store.SumActions(ActionFilter{AppID: app.ID})
+	if err != nil || sum != 0 {
+		t.Errorf("Expected the deleted Apps buckets to be deleted, got %d (%v)", sum, err)
+	}
+}
+
+func TestAppResolution(t *testing.T) {
+	s, e := newTestService(t)
+	ninetyMinutesAgo := time.Now().Add(-90 * time.Minute)
+
+	// Actions are stored in buckets of the Apps resolution
+	for resolution, size := range map[string]time.Duration{
+		"minute": time.Minute,
+		"hour":   time.Hour,
+		"day":    24 * time.Hour,
+	} {
+		app := createTestApp(t, e, "resolution="+resolution)
+		if app.Resolution != resolution {
+			t.Errorf("Expected an App with a resolution of %s, got %q", resolution, app.Resolution)
+		}
+		path := fmt.Sprintf("/v1/app/%s/action/signup/create/4?timestamp=%d",
+			app.ID, ninetyMinutesAgo.Unix())
+		if code := testRequest(t, e, http.MethodPost, path, app.Token, nil, nil); code != http.StatusOK {
+			t.Fatalf("Expected CreateAction to return 200, got %d", code)
+		}
+		buckets, err := s.store.SumActionBuckets(ActionFilter{AppID: app.ID})
+		if err != nil {
+			t.Fatalf("Failed to retrieve buckets: %v", err)
+		}
+		expected := ninetyMinutesAgo.UTC().Truncate(size)
+		if len(buckets) != 1 || !buckets[0].Timestamp.Equal(expected) || buckets[0].Total != 4 {
+			t.Errorf("Expected a %s bucket at %s, got %+v", resolution, expected, buckets)
+		}
+
+		// Minute buckets are precise enough to exclude the action from
+		// the last hour
+		if resolution == "minute" {
+			countPath := fmt.Sprintf("/v1/app/%s/action/signup/count/", app.ID)
+			if count := testCount(t, e, countPath+"1h", ""); count != 0 {
+				t.Errorf("Expected a count of 0 in the last hour, got %d", count)
+			}
+			if count := testCount(t, e, countPath+"2h", ""); count != 4 {
+				t.Errorf("Expected a count of 4 in the last 2 hours, got %d", count)
+			}
+		}
+	}
+
+	// Unknown resolutions are rejected
+	if code := testRequest(t, e, http.MethodPost, "/v1/app/create/test?resolution=second",
+		testAdminToken, nil, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown resolution to return 400, got %d", code)
+	}
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/sdwolfe32/tinystat/client"
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+const (
+	// maxBatchActions is the maximum number of entries that may be
+	// submitted in a single CreateActions request
+	maxBatchActions = 1000
+	// maxActionLength is the maximum length of an action name
+	maxActionLength = 100
+)
+
+var (
+	// ErrInvalidBatch is thrown when we fail to decode a batch of actions
+	ErrInvalidBatch = echo.NewHTTPError(http.StatusBadRequest, "Failed to decode batch of actions")
+	// ErrTooManyActions is thrown when too many actions are submitted at once
+	ErrTooManyActions = echo.NewHTTPError(http.StatusBadRequest, "Too many actions in batch (max 1000)")
+	// ErrInvalidActionName is thrown when an action name is empty or too long
+	ErrInvalidActionName = echo.NewHTTPError(http.StatusBadRequest, "Action names must be 1-100 characters")
+	// ErrInvalidCount is thrown when an action is created with a count below 1
+	ErrInvalidCount = echo.NewHTTPError(http.StatusBadRequest, "Counts must be at least 1")
+)
+
+// invalidBatchMessage is the message a batch containing invalid
+// entries is rejected with
+const invalidBatchMessage = "Invalid actions in batch"
+
+// ActionIncrement is a single count of an action to be added to the
+// bucket containing its timestamp
+type ActionIncrement struct {
+	Action    string
+	Tags      models.Tags
+	Count     int64
+	Timestamp time.Time
+}
+
+// CreateActions increments the counts of many actions at once. The
+// body should be a JSON array of models.ActionEntry and every entry
+// is applied transactionally. If any entry is invalid none are
+// applied and a 400 listing every invalid entry by index is returned
+// as a models.ActionBatchError. Timestamps may be at most the Apps max skew in the future
+// and max backfill in the past. If sent_at is passed, timestamps are
+// treated as recorded by a clock reading sent_at when the batch was
+// sent and are shifted onto the servers clock
+// Endpoint: /app/:app_id/actions?sent_at=:sent_at
+func (s *Service) CreateActions(c echo.Context) error {
+	l := s.logger.WithField("method", "create_actions")
+	l.Debug("Received new CreateActions request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	var entries []models.ActionEntry
+	if err := c.Bind(&entries); err != nil {
+		l.WithError(err).Error("Failed to decode batch of actions")
+		return ErrInvalidBatch
+	}
+	if len(entries) > maxBatchActions {
+		l.WithError(ErrTooManyActions).Error("Too many actions in batch")
+		return ErrTooManyActions
+	}
+	l = l.WithFields(map[string]interface{}{"app_id": appID, "actions": len(entries)})
+
+	// Retrieve the App to determine its bucket resolution
+	app, err := s.requestApp(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return ErrAppRetrievalFailure
+	}
+
+	// Determine how far the senders clock is from ours if it passed
+	// the time it sent the batch
+	now := time.Now()
+	var clockOffset time.Duration
+	if value := c.QueryParam("sent_at"); value != "" {
+		sentAt, err := parseTime(value)
+		if err != nil {
+			l.WithError(err).Error("Failed to parse sent_at time")
+			return ErrParseTimeFailure
+		}
+		clockOffset = now.Sub(sentAt)
+	}
+
+	// Validate every entry before any are stored
+	l.Debug("Validating batch of actions")
+	var rejected []models.RejectedEntry
+	increments := make([]ActionIncrement, 0, len(entries))
+	for i, entry := range entries {
+		if !entry.Timestamp.IsZero() {
+			entry.Timestamp = entry.Timestamp.Add(clockOffset)
+		}
+		increment, err := s.actionIncrement(app, entry, now)
+		if err != nil {
+			l.WithError(err).WithField("index", i).Error("Invalid action entry")
+			rejected = append(rejected, models.RejectedEntry{Index: i, Message: errorMessage(err)})
+			continue
+		}
+		increments = append(increments, increment)
+	}
+	if len(rejected) > 0 {
+		return c.JSON(http.StatusBadRequest, models.ActionBatchError{
+			Message: invalidBatchMessage, Rejected: rejected})
+	}
+
+	// Store every action in the database
+	l.Debug("Incrementing Action counts in DB")
+	if err := s.store.IncrementActions(app.ID, increments); err != nil {
+		l.WithError(err).Error("Failed to increment Action counts")
+		return ErrIncrementFailure
+	}
+	timestamps := make([]time.Time, 0, len(increments))
+	for _, inc := range increments {
+		timestamps = append(timestamps, inc.Timestamp)
+	}
+	s.backfillRollups(timestamps...)
+
+	// Report the successful create-actions to ourselves
+	go client.CreateActions("create-action", int64(len(increments)))
+
+	// Return a successful response
+	l.Debug("Returning successful CreateActions response")
+	return c.JSON(http.StatusOK, nil)
+}
+
+// actionIncrement validates a single batch entry and returns the
+// increment it applies to the Apps buckets
+func (s *Service) actionIncrement(app *App, entry models.ActionEntry, now time.Time) (ActionIncrement, error) {
+	if entry.Action == "" || len(entry.Action) > maxActionLength {
+		return ActionIncrement{}, ErrInvalidActionName
+	}
+	if entry.Count < 1 {
+		return ActionIncrement{}, ErrInvalidCount
+	}
+	tags, err := models.ParseTags(entry.Tags)
+	if err != nil {
+		return ActionIncrement{}, ErrInvalidTags
+	}
+	timestamp, err := s.eventTime(app, entry.Timestamp, now)
+	if err != nil {
+		return ActionIncrement{}, err
+	}
+	return ActionIncrement{Action: entry.Action, Tags: tags,
+		Count: entry.Count, Timestamp: app.bucket(timestamp)}, nil
+}
+
+// errorMessage returns the message an error is reported to clients
+// with
+func errorMessage(err error) string {
+	if httpErr, ok := err.(*echo.HTTPError); ok {
+		return fmt.Sprint(httpErr.Message)
+	}
+	return err.Error()
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/sdwolfe32/tinystat/models"
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrCompareGroupBy is thrown when a compared summary is grouped by a tag
+var ErrCompareGroupBy = echo.NewHTTPError(http.StatusBadRequest, "Summaries can't be both compared and grouped")
+
+// previousRollingSummaryStarts returns the start of the window
+// preceding every rolling ActionSummary window
+func previousRollingSummaryStarts(now time.Time) summaryStarts {
+	return summaryStarts{
+		Hour:  now.Add(-2 * time.Hour),
+		Day:   now.Add(-2 * time.Hour * 24),
+		Week:  now.Add(-2 * time.Hour * 24 * 7),
+		Month: now.Add(-2 * time.Hour * 24 * 30),
+		Year:  now.Add(-2 * time.Hour * 24 * 365),
+	}
+}
+
+// previousCalendarSummaryStarts returns the start of the previous
+// hour, day, week (beginning Monday), month and year in the location
+// of now
+func previousCalendarSummaryStarts(now time.Time) summaryStarts {
+	y, m, d := now.Date()
+	loc := now.Location()
+	daysSinceMonday := (int(now.Weekday()) + 6) % 7
+	return summaryStarts{
+		Hour:  time.Date(y, m, d, now.Hour()-1, 0, 0, 0, loc),
+		Day:   time.Date(y, m, d-1, 0, 0, 0, 0, loc),
+		Week:  time.Date(y, m, d-daysSinceMonday-7, 0, 0, 0, 0, loc),
+		Month: time.Date(y, m-1, 1, 0, 0, 0, 0, loc),
+		Year:  time.Date(y-1, time.January, 1, 0, 0, 0, 0, loc),
+	}
+}
+
+// comparedSummary retrieves the count of every summary window along
+// with the count of the window preceding it. Each preceding window
+// covers as much time after its start as has passed since the start
+// of the current window, so a week to date is compared to the same
+// part of the previous week. Like the current window, it includes the
+// whole bucket its end occurs in
+func (s *Service) comparedSummary(app *App, filter ActionFilter, now time.Time, starts, previous summaryStarts) (*models.ActionSummaryComparison, error) {
+	var g errgroup.Group
+	var current, prior models.ActionSummary
+	compare := func(cur, prev *int64, start, prevStart time.Time) {
+		prevEnd := app.bucket(prevStart.Add(now.Sub(start))).Add(app.resolution())
+		if end := s.bucketStart(app, start); prevEnd.After(end) {
+			prevEnd = end // Never overlap the current window
+		}
+		g.Go(func() error { return s.timedActionSum(cur, app, filter, start) })
+		g.Go(func() error { return s.periodActionSum(prev, app, filter, prevStart, prevEnd) })
+	}
+	compare(&current.Hour, &prior.Hour, starts.Hour, previous.Hour)
+	compare(&current.Day, &prior.Day, starts.Day, previous.Day)
+	compare(&current.Week, &prior.Week, starts.Week, previous.Week)
+	compare(&current.Month, &prior.Month, starts.Month, previous.Month)
+	compare(&current.Year, &prior.Year, starts.Year, previous.Year)
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return &models.ActionSummaryComparison{
+		Hour:  models.NewComparison(current.Hour, prior.Hour),
+		Day:   models.NewComparison(current.Day, prior.Day),
+		Week:  models.NewComparison(current.Week, prior.Week),
+		Month: models.NewComparison(current.Month, prior.Month),
+		Year:  models.NewComparison(current.Year, prior.Year),
+	}, nil
+}
+
+// periodActionSum returns a sum specifically tailored to the
+// requested filter and only occuring in or after the bucket containing
+// the passed start time and before the passed bucket aligned end time
+func (s *Service) periodActionSum(out *int64, app *App, filter ActionFilter, start, end time.Time) error {
+	filter.Start = s.bucketStart(app, start)
+	filter.End = end
+	return s.actionSum(out, filter)
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+func TestActionSummaryCompare(t *testing.T) {
+	_, e := newTestService(t)
+	app := createTestApp(t, e, "resolution=minute")
+
+	// Create actions in the current and previous hour
+	for _, path := range []string{
+		"/v1/app/%s/action/signup/create/3",
+		fmt.Sprintf("/v1/app/%%s/action/signup/create/2?timestamp=%d", time.Now().Add(-90*time.Minute).Unix()),
+	} {
+		if code := testRequest(t, e, http.MethodPost, fmt.Sprintf(path, app.ID),
+			app.Token, nil, nil); code != http.StatusOK {
+			t.Fatalf("Expected POST %s to return 200, got %d", path, code)
+		}
+	}
+
+	// Every window is compared to the one preceding it
+	var comparison models.ActionSummaryComparison
+	path := fmt.Sprintf("/v1/app/%s/action/signup/count", app.ID)
+	if code := testRequest(t, e, http.MethodGet, path+"?compare=true", "",
+		nil, &comparison); code != http.StatusOK {
+		t.Fatalf("Expected a compared ActionSummary to return 200, got %d", code)
+	}
+	hour := comparison.Hour
+	if hour.Current != 3 || hour.Previous != 2 || hour.Change != 1 ||
+		hour.PercentChange == nil || *hour.PercentChange != 50 {
+		t.Errorf("Expected the hour to be compared to the previous hour, got %+v", hour)
+	}
+	day := comparison.Day
+	if day.Current != 5 || day.Previous != 0 || day.Change != 5 || day.PercentChange != nil {
+		t.Errorf("Expected the day to be compared to an empty previous day, got %+v", day)
+	}
+
+	// Compared summaries can't be grouped
+	if code := testRequest(t, e, http.MethodGet, path+"?compare=true&group_by=platform",
+		"", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected a compared and grouped ActionSummary to return 400, got %d", code)
+	}
+}
+
+func TestPreviousCalendarSummaryStarts(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Failed to load timezone: %v", err)
+	}
+
+	// Every previous window may start in the previous year
+	now := time.Date(2018, time.January, 3, 15, 30, 0, 0, loc)
+	previous := previousCalendarSummaryStarts(now)
+	for name, test := range map[string]struct{ got, expected time.Time }{
+		"hour":  {previous.Hour, time.Date(2018, time.January, 3, 14, 0, 0, 0, loc)},
+		"day":   {previous.Day, time.Date(2018, time.January, 2, 0, 0, 0, 0, loc)},
+		"week":  {previous.Week, time.Date(2017, time.December, 25, 0, 0, 0, 0, loc)},
+		"month": {previous.Month, time.Date(2017, time.December, 1, 0, 0, 0, 0, loc)},
+		"year":  {previous.Year, time.Date(2017, time.January, 1, 0, 0, 0, 0, loc)},
+	} {
+		if !test.got.Equal(test.expected) {
+			t.Errorf("Expected the previous %s to start at %s, got %s", name, test.expected, test.got)
+		}
+	}
+}
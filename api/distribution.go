@@ -0,0 +1,254 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/sdwolfe32/tinystat/client"
+	"github.com/sdwolfe32/tinystat/models"
+	"github.com/sdwolfe32/tinystat/sketch"
+)
+
+var (
+	// ErrInvalidHistogram is thrown when we fail to decode a submitted histogram
+	ErrInvalidHistogram = echo.NewHTTPError(http.StatusBadRequest, "Failed to decode histogram")
+	// ErrDistributionMergeFailure is thrown when we fail to store a submitted histogram
+	ErrDistributionMergeFailure = echo.NewHTTPError(http.StatusInternalServerError, "Failed to store histogram")
+	// ErrPercentilesFailure is thrown when we fail to retrieve percentiles
+	ErrPercentilesFailure = echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve percentiles")
+)
+
+// Distribution is a histogram of the values observed for an action
+// (ex: latencies) within a single bucket
+type Distribution struct {
+	ID        string    `gorm:"primary_key"`
+	AppID     string    `gorm:"type:varchar(10);not null"`
+	Action    string    `gorm:"type:varchar(100);not null"`
+	Sketch    []byte    `gorm:"not null"`
+	Timestamp time.Time `sql:"index"`
+}
+
+// histogram decodes the stored histogram, returning an empty
+// Histogram if the bucket doesn't have one yet
+func (d *Distribution) histogram() (*sketch.Histogram, error) {
+	hist := sketch.NewHistogram()
+	if len(d.Sketch) == 0 {
+		return hist, nil
+	}
+	return hist, json.Unmarshal(d.Sketch, hist)
+}
+
+// merge merges the passed Histogram into the stored histogram
+func (d *Distribution) merge(other *sketch.Histogram) error {
+	hist, err := d.histogram()
+	if err != nil {
+		return err
+	}
+	hist.Merge(other)
+	d.Sketch, err = json.Marshal(hist)
+	return err
+}
+
+// CreateDistribution merges a histogram of observed values into the
+// distribution of an action in the Apps current bucket. The body
+// should be a JSON encoded sketch.Histogram
+// Endpoint: /action/:app_id/action/:action/distribution
+func (s *Service) CreateDistribution(c echo.Context) error {
+	l := s.logger.WithField("method", "create_distribution")
+	l.Debug("Received new CreateDistribution request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	action := c.Param("action")
+	hist := sketch.NewHistogram()
+	if err := c.Bind(hist); err != nil {
+		l.WithError(err).Error("Failed to decode histogram")
+		return ErrInvalidHistogram
+	}
+	l = l.WithFields(map[string]interface{}{
+		"app_id": appID, "action": action, "count": hist.Count})
+
+	// Retrieve the App to determine its bucket resolution
+	app, err := s.requestApp(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return ErrAppRetrievalFailure
+	}
+
+	// Merge the histogram into the database
+	l.Debug("Merging histogram in DB")
+	if err := s.store.MergeDistribution(app.ID, action, hist, app.bucket(time.Now())); err != nil {
+		l.WithError(err).Error("Failed to merge histogram")
+		return ErrDistributionMergeFailure
+	}
+
+	// Report the successful create-distribution to ourselves
+	go client.CreateAction("create-distribution")
+
+	// Return a Status OK
+	l.Debug("Returning successful CreateDistribution response")
+	return c.JSON(http.StatusOK, nil)
+}
+
+// ActionPercentiles retrieves the p50, p90, p99 and max of all values
+// observed for an action in the passed duration. Duration should
+// match the same formatting as https://golang.org/pkg/time/#ParseDuration
+// Endpoint: /action/:app_id/action/:action/percentiles/:duration
+func (s *Service) ActionPercentiles(c echo.Context) error {
+	l := s.logger.WithField("method", "action_percentiles")
+	l.Debug("Received new ActionPercentiles request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	action := c.Param("action")
+	duration := c.Param("duration")
+	l = l.WithFields(map[string]interface{}{
+		"app_id": appID, "action": action, "duration": duration})
+
+	// Parse the duration passed
+	l.Debug("Parsing the requested duration")
+	dur, err := time.ParseDuration(duration)
+	if err != nil {
+		l.WithError(err).Error("Failed to parse duration")
+		return ErrParseDurationFailure
+	}
+
+	// Retrieve the App to determine its bucket resolution
+	app, err := s.requestApp(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return ErrAppRetrievalFailure
+	}
+
+	// Retrieve the percentiles from the DB and return
+	l.Debug("Retrieve the percentiles from the DB")
+	var percentiles models.Percentiles
+	if err := s.percentiles(&percentiles, ActionFilter{AppID: appID, Action: action,
+		Start: s.bucketStart(app, time.Now().Add(-1*dur))}); err != nil {
+		l.WithError(err).Error("Failed to retrieve percentiles")
+		return ErrPercentilesFailure
+	}
+
+	// Report the successful action-percentiles to ourselves
+	go client.CreateAction("action-percentiles")
+
+	// Return an Status OK
+	l.Debug("Returning successful ActionPercentiles response")
+	return c.JSON(http.StatusOK, percentiles)
+}
+
+// ActionRangePercentiles retrieves the p50, p90, p99 and max of all
+// values observed for an action between two absolute times. Times
+// behave the same as in ActionRangeCount
+// Endpoint: /action/:app_id/action/:action/percentiles?from=:from&to=:to
+func (s *Service) ActionRangePercentiles(c echo.Context) error {
+	l := s.logger.WithField("method", "action_range_percentiles")
+	l.Debug("Received new ActionRangePercentiles request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	action := c.Param("action")
+	l = l.WithFields(map[string]interface{}{"app_id": appID, "action": action})
+
+	// Parse the requested time range
+	l.Debug("Parsing the requested time range")
+	from, to, err := parseTimeRange(c, nil)
+	if err != nil {
+		l.WithError(err).Error("Failed to parse time range")
+		return err
+	}
+	l = l.WithFields(map[string]interface{}{"from": from, "to": to})
+
+	// Retrieve the App to determine its bucket resolution
+	app, err := s.requestApp(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return ErrAppRetrievalFailure
+	}
+
+	// Retrieve the percentiles from the DB and return
+	l.Debug("Retrieve the percentiles from the DB")
+	var percentiles models.Percentiles
+	if err := s.percentiles(&percentiles, ActionFilter{AppID: appID, Action: action,
+		Start: s.bucketStart(app, from), End: to}); err != nil {
+		l.WithError(err).Error("Failed to retrieve percentiles")
+		return ErrPercentilesFailure
+	}
+
+	// Report the successful action-range-percentiles to ourselves
+	go client.CreateAction("action-range-percentiles")
+
+	// Return an Status OK
+	l.Debug("Returning successful ActionRangePercentiles response")
+	return c.JSON(http.StatusOK, percentiles)
+}
+
+// percentiles merges every distribution bucket matching the filter
+// and estimates the percentiles of their values
+func (s *Service) percentiles(out *models.Percentiles, filter ActionFilter) error {
+	hist, err := s.store.DistributionSketch(filter)
+	if err != nil {
+		return err
+	}
+	*out = models.Percentiles{
+		Count:         hist.Count,
+		Min:           hist.Min,
+		Avg:           hist.Mean(),
+		P50:           hist.Quantile(0.5),
+		P90:           hist.Quantile(0.9),
+		P99:           hist.Quantile(0.99),
+		Max:           hist.Max,
+		RelativeError: sketch.HistogramRelativeError,
+	}
+	return nil
+}
+
+// mergeDistributions merges the histograms of every passed
+// distribution bucket into a single Histogram
+func mergeDistributions(distributions []*Distribution) (*sketch.Histogram, error) {
+	merged := sketch.NewHistogram()
+	for _, d := range distributions {
+		hist, err := d.histogram()
+		if err != nil {
+			return nil, err
+		}
+		merged.Merge(hist)
+	}
+	return merged, nil
+}
+
+// rollupDistributions groups the passed distribution buckets by app
+// and action and merges every group with more than one bucket into a
+// single bucket timestamped at start
+func rollupDistributions(distributions []*Distribution, start time.Time) ([]*Distribution, error) {
+	groups := make(map[[2]string][]*Distribution)
+	for _, d := range distributions {
+		group := [2]string{d.AppID, d.Action}
+		groups[group] = append(groups[group], d)
+	}
+
+	var merged []*Distribution
+	for group, buckets := range groups {
+		if len(buckets) < 2 {
+			continue
+		}
+		hist, err := mergeDistributions(buckets)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(hist)
+		if err != nil {
+			return nil, err
+		}
+		merged = append(merged, &Distribution{
+			ID:        generateKey(group[0], group[1], "", start),
+			AppID:     group[0],
+			Action:    group[1],
+			Sketch:    data,
+			Timestamp: start.UTC(),
+		})
+	}
+	return merged, nil
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"testing"
+
+	"github.com/sdwolfe32/tinystat/models"
+	"github.com/sdwolfe32/tinystat/sketch"
+)
+
+func TestPercentiles(t *testing.T) {
+	_, e := newTestService(t)
+	app := createTestApp(t, e, "")
+
+	// Submit two histograms to the same bucket, splitting 1 to 1000
+	path := fmt.Sprintf("/v1/app/%s/action/request/distribution", app.ID)
+	odd, even := sketch.NewHistogram(), sketch.NewHistogram()
+	for i := 1; i <= 1000; i++ {
+		if i%2 == 0 {
+			even.Add(float64(i))
+		} else {
+			odd.Add(float64(i))
+		}
+	}
+	for _, hist := range []*sketch.Histogram{odd, even} {
+		if code := testRequest(t, e, http.MethodPost, path, app.Token, hist, nil); code != http.StatusOK {
+			t.Fatalf("Expected CreateDistribution to return 200, got %d", code)
+		}
+	}
+	if code := testRequest(t, e, http.MethodPost, path, app.Token,
+		map[string]interface{}{"bins": map[string]int{"1": 2}, "count": 1}, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected an inconsistent histogram to return 400, got %d", code)
+	}
+
+	// Every percentile of the merged histograms is within the error
+	var p models.Percentiles
+	path = fmt.Sprintf("/v1/app/%s/action/request/percentiles/1h", app.ID)
+	if code := testRequest(t, e, http.MethodGet, path, "", nil, &p); code != http.StatusOK {
+		t.Fatalf("Expected ActionPercentiles to return 200, got %d", code)
+	}
+	if p.Count != 1000 || p.Min != 1 || p.Max != 1000 || p.Avg != 500.5 {
+		t.Errorf("Expected exact count, min, max and average, got %+v", p)
+	}
+	for _, test := range []struct{ value, expected float64 }{
+		{p.P50, 500}, {p.P90, 900}, {p.P99, 990},
+	} {
+		if math.Abs(test.value-test.expected) > p.RelativeError*test.expected*(1+1e-9) {
+			t.Errorf("Expected a percentile within %.1f%% of %v, got %v",
+				100*p.RelativeError, test.expected, test.value)
+		}
+	}
+}
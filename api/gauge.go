@@ -0,0 +1,280 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/sdwolfe32/tinystat/client"
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+var (
+	// ErrParseGaugeFailure is thrown when we fail to parse a gauge value
+	ErrParseGaugeFailure = echo.NewHTTPError(http.StatusBadRequest, "Failed to parse gauge value")
+	// ErrInvalidGauge is thrown when submitted gauge samples are inconsistent
+	ErrInvalidGauge = echo.NewHTTPError(http.StatusBadRequest, "Gauge samples must be finite with min <= last <= max and at least one sample")
+	// ErrGaugeRecordFailure is thrown when we fail to store a gauge value
+	ErrGaugeRecordFailure = echo.NewHTTPError(http.StatusInternalServerError, "Failed to record Gauge value")
+	// ErrGaugeStatsFailure is thrown when we fail to retrieve gauge stats
+	ErrGaugeStatsFailure = echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve Gauge stats")
+)
+
+// Gauge is the last, min, max and sum of all samples of a gauge
+// within a single bucket
+type Gauge struct {
+	ID        string    `gorm:"primary_key"`
+	AppID     string    `gorm:"type:varchar(10);not null"`
+	Name      string    `gorm:"type:varchar(100);not null"`
+	Last      float64   `gorm:"not null"`
+	Min       float64   `gorm:"not null"`
+	Max       float64   `gorm:"not null"`
+	Sum       float64   `gorm:"not null"`
+	Samples   int64     `gorm:"not null"`
+	LastAt    time.Time `gorm:"not null"`
+	Timestamp time.Time `sql:"index"`
+}
+
+// value returns the samples of the bucket as a models.Gauge
+func (g *Gauge) value() models.Gauge {
+	return models.Gauge{Last: g.Last, Min: g.Min, Max: g.Max,
+		Sum: g.Sum, Samples: g.Samples, LastAt: g.LastAt}
+}
+
+// merge merges the passed samples into the bucket
+func (g *Gauge) merge(other models.Gauge) {
+	v := g.value()
+	v.Merge(other)
+	g.Last, g.Min, g.Max, g.Sum = v.Last, v.Min, v.Max, v.Sum
+	g.Samples, g.LastAt = v.Samples, v.LastAt.UTC()
+}
+
+// SetGauge records a single value of a gauge in the Apps current
+// bucket
+// Endpoint: /app/:app_id/gauge/:gauge/set/:value
+func (s *Service) SetGauge(c echo.Context) error {
+	l := s.logger.WithField("method", "set_gauge")
+	l.Debug("Received new SetGauge request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	gauge := c.Param("gauge")
+	value, err := strconv.ParseFloat(c.Param("value"), 64)
+	if err == nil && (math.IsNaN(value) || math.IsInf(value, 0)) {
+		err = ErrParseGaugeFailure
+	}
+	if err != nil {
+		l.WithError(err).Error("Failed to parse requested gauge value")
+		return ErrParseGaugeFailure
+	}
+	l = l.WithFields(map[string]interface{}{
+		"app_id": appID, "gauge": gauge, "value": value})
+
+	// Retrieve the App to determine its bucket resolution
+	app, err := s.requestApp(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return ErrAppRetrievalFailure
+	}
+
+	// Store the new value in the database
+	l.Debug("Recording Gauge value in DB")
+	now := time.Now()
+	var samples models.Gauge
+	samples.Set(value, now)
+	if err := s.store.RecordGauge(app.ID, gauge, samples, app.bucket(now)); err != nil {
+		l.WithError(err).Error("Failed to record Gauge value")
+		return ErrGaugeRecordFailure
+	}
+
+	// Report the successful set-gauge to ourselves
+	go client.CreateAction("set-gauge")
+
+	// Return a Status OK
+	l.Debug("Returning successful SetGauge response")
+	return c.JSON(http.StatusOK, nil)
+}
+
+// MergeGauge records samples of a gauge already aggregated by the
+// client in the Apps current bucket. The body should be JSON
+// formatted as {"last": 3, "min": 1, "max": 5, "sum": 9, "samples": 3}
+// Endpoint: /app/:app_id/gauge/:gauge
+func (s *Service) MergeGauge(c echo.Context) error {
+	l := s.logger.WithField("method", "merge_gauge")
+	l.Debug("Received new MergeGauge request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	gauge := c.Param("gauge")
+	var samples models.Gauge
+	if err := c.Bind(&samples); err != nil {
+		l.WithError(err).Error("Failed to decode gauge samples")
+		return ErrInvalidGauge
+	}
+	if samples.Samples < 1 || samples.Min > samples.Last || samples.Last > samples.Max ||
+		math.IsInf(samples.Sum, 0) || math.IsInf(samples.Max, 0) || math.IsInf(samples.Min, 0) {
+		l.WithError(ErrInvalidGauge).Error("Invalid gauge samples")
+		return ErrInvalidGauge
+	}
+	l = l.WithFields(map[string]interface{}{
+		"app_id": appID, "gauge": gauge, "samples": samples.Samples})
+
+	// Retrieve the App to determine its bucket resolution
+	app, err := s.requestApp(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return ErrAppRetrievalFailure
+	}
+
+	// Store the new samples in the database. Last is always
+	// considered sampled on receipt so clocks of clients don't matter
+	l.Debug("Recording Gauge samples in DB")
+	now := time.Now()
+	samples.LastAt = now
+	if err := s.store.RecordGauge(app.ID, gauge, samples, app.bucket(now)); err != nil {
+		l.WithError(err).Error("Failed to record Gauge samples")
+		return ErrGaugeRecordFailure
+	}
+
+	// Report the successful merge-gauge to ourselves
+	go client.CreateAction("merge-gauge")
+
+	// Return a Status OK
+	l.Debug("Returning successful MergeGauge response")
+	return c.JSON(http.StatusOK, nil)
+}
+
+// GaugeStats retrieves the last, min, max, average and sum of all
+// samples of a gauge in the passed duration. Duration should match
+// the same formatting as https://golang.org/pkg/time/#ParseDuration
+// Endpoint: /app/:app_id/gauge/:gauge/stats/:duration
+func (s *Service) GaugeStats(c echo.Context) error {
+	l := s.logger.WithField("method", "gauge_stats")
+	l.Debug("Received new GaugeStats request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	gauge := c.Param("gauge")
+	duration := c.Param("duration")
+	l = l.WithFields(map[string]interface{}{
+		"app_id": appID, "gauge": gauge, "duration": duration})
+
+	// Parse the duration passed
+	l.Debug("Parsing the requested duration")
+	dur, err := time.ParseDuration(duration)
+	if err != nil {
+		l.WithError(err).Error("Failed to parse duration")
+		return ErrParseDurationFailure
+	}
+
+	// Retrieve the App to determine its bucket resolution
+	app, err := s.requestApp(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return ErrAppRetrievalFailure
+	}
+
+	// Retrieve the gauge stats from the DB and return
+	l.Debug("Retrieve the Gauge stats from the DB")
+	var stats models.GaugeStats
+	if err := s.gaugeStats(&stats, ActionFilter{AppID: appID, Action: gauge,
+		Start: s.bucketStart(app, time.Now().Add(-1*dur))}); err != nil {
+		l.WithError(err).Error("Failed to retrieve Gauge stats")
+		return ErrGaugeStatsFailure
+	}
+
+	// Report the successful gauge-stats to ourselves
+	go client.CreateAction("gauge-stats")
+
+	// Return an Status OK
+	l.Debug("Returning successful GaugeStats response")
+	return c.JSON(http.StatusOK, stats)
+}
+
+// GaugeRangeStats retrieves the last, min, max, average and sum of
+// all samples of a gauge between two absolute times. Times behave
+// the same as in ActionRangeCount
+// Endpoint: /app/:app_id/gauge/:gauge/range?from=:from&to=:to
+func (s *Service) GaugeRangeStats(c echo.Context) error {
+	l := s.logger.WithField("method", "gauge_range_stats")
+	l.Debug("Received new GaugeRangeStats request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	gauge := c.Param("gauge")
+	l = l.WithFields(map[string]interface{}{"app_id": appID, "gauge": gauge})
+
+	// Parse the requested time range
+	l.Debug("Parsing the requested time range")
+	from, to, err := parseTimeRange(c, nil)
+	if err != nil {
+		l.WithError(err).Error("Failed to parse time range")
+		return err
+	}
+	l = l.WithFields(map[string]interface{}{"from": from, "to": to})
+
+	// Retrieve the App to determine its bucket resolution
+	app, err := s.requestApp(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return ErrAppRetrievalFailure
+	}
+
+	// Retrieve the gauge stats from the DB and return
+	l.Debug("Retrieve the Gauge stats from the DB")
+	var stats models.GaugeStats
+	if err := s.gaugeStats(&stats, ActionFilter{AppID: appID, Action: gauge,
+		Start: s.bucketStart(app, from), End: to}); err != nil {
+		l.WithError(err).Error("Failed to retrieve Gauge stats")
+		return ErrGaugeStatsFailure
+	}
+
+	// Report the successful gauge-range-stats to ourselves
+	go client.CreateAction("gauge-range-stats")
+
+	// Return an Status OK
+	l.Debug("Returning successful GaugeRangeStats response")
+	return c.JSON(http.StatusOK, stats)
+}
+
+// gaugeStats aggregates the samples of every gauge bucket matching
+// the filter
+func (s *Service) gaugeStats(out *models.GaugeStats, filter ActionFilter) error {
+	gauge, err := s.store.AggregateGauge(filter)
+	if err != nil {
+		return err
+	}
+	*out = gauge.Stats()
+	return nil
+}
+
+// rollupGauges groups the passed gauge buckets by app and name and
+// merges every group with more than one bucket into a single bucket
+// timestamped at start
+func rollupGauges(gauges []*Gauge, start time.Time) []*Gauge {
+	groups := make(map[[2]string][]*Gauge)
+	for _, g := range gauges {
+		group := [2]string{g.AppID, g.Name}
+		groups[group] = append(groups[group], g)
+	}
+
+	var merged []*Gauge
+	for group, buckets := range groups {
+		if len(buckets) < 2 {
+			continue
+		}
+		rolled := &Gauge{
+			ID:        generateKey(group[0], group[1], "", start),
+			AppID:     group[0],
+			Name:      group[1],
+			Timestamp: start.UTC(),
+		}
+		for _, g := range buckets {
+			rolled.merge(g.value())
+		}
+		merged = append(merged, rolled)
+	}
+	return merged
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+func TestGauge(t *testing.T) {
+	s, e := newTestService(t)
+	app := createTestApp(t, e, "")
+	path := fmt.Sprintf("/v1/app/%s/gauge/queue", app.ID)
+
+	// Record single values and samples aggregated by the client
+	for _, value := range []string{"3", "5", "1"} {
+		if code := testRequest(t, e, http.MethodPost, path+"/set/"+value, app.Token,
+			nil, nil); code != http.StatusOK {
+			t.Fatalf("Expected SetGauge to return 200, got %d", code)
+		}
+	}
+	samples := models.Gauge{Last: 4, Min: 2, Max: 9, Sum: 15, Samples: 3}
+	if code := testRequest(t, e, http.MethodPost, path, app.Token, samples, nil); code != http.StatusOK {
+		t.Fatalf("Expected MergeGauge to return 200, got %d", code)
+	}
+
+	// Every sample is aggregated and the last one received is kept
+	var stats models.GaugeStats
+	if code := testRequest(t, e, http.MethodGet, path+"/stats/1h", "", nil, &stats); code != http.StatusOK {
+		t.Fatalf("Expected GaugeStats to return 200, got %d", code)
+	}
+	if stats.Last != 4 || stats.Min != 1 || stats.Max != 9 || stats.Sum != 24 ||
+		stats.Samples != 6 || stats.Avg != 4 {
+		t.Errorf("Expected the stats of every sample, got %+v", stats)
+	}
+
+	// Ranges only include the samples between from and to
+	from := app.bucket(time.Now().Add(-48 * time.Hour))
+	if err := s.store.RecordGauge(app.ID, "queue", models.Gauge{Last: 7, Min: 7, Max: 7,
+		Sum: 7, Samples: 1, LastAt: from}, from); err != nil {
+		t.Fatalf("Failed to seed Gauge: %v", err)
+	}
+	rangePath := fmt.Sprintf("%s/range?from=%d&to=%d", path, from.Unix(), from.Add(time.Hour).Unix())
+	if code := testRequest(t, e, http.MethodGet, rangePath, "", nil, &stats); code != http.StatusOK {
+		t.Fatalf("Expected GaugeRangeStats to return 200, got %d", code)
+	}
+	if stats.Samples != 1 || stats.Last != 7 || stats.Avg != 7 {
+		t.Errorf("Expected only the seeded sample in the range, got %+v", stats)
+	}
+
+	// Invalid values, samples and durations are rejected
+	for _, test := range []struct {
+		method, path string
+		in           interface{}
+	}{
+		{http.MethodPost, path + "/set/many", nil},
+		{http.MethodPost, path + "/set/NaN", nil},
+		{http.MethodPost, path, models.Gauge{Last: 1, Min: 2, Max: 3, Sum: 6, Samples: 3}},
+		{http.MethodPost, path, models.Gauge{Last: 1, Min: 1, Max: 1, Sum: 1}},
+		{http.MethodGet, path + "/stats/forever", nil},
+	} {
+		if code := testRequest(t, e, test.method, test.path, app.Token, test.in, nil); code != http.StatusBadRequest {
+			t.Errorf("Expected %s %s to return 400, got %d", test.method, test.path, code)
+		}
+	}
+}
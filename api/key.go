@@ -0,0 +1,276 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/sdwolfe32/tinystat/client"
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+const (
+	// maxKeyNameLength is the maximum length of a Key name
+	maxKeyNameLength = 100
+	// keyCacheExp is how long Keys are cached for, bounding how long a
+	// revoked Key remains valid on other servers
+	keyCacheExp = time.Minute
+	// keyTokenSeparator separates the ID and secret of a Key token
+	keyTokenSeparator = "."
+)
+
+var (
+	// ErrInvalidKeyName is thrown when a Key name is empty or too long
+	ErrInvalidKeyName = echo.NewHTTPError(http.StatusBadRequest, "Key name must be 1 to 100 characters")
+	// ErrInvalidScopes is thrown when the requested Key scopes can't be parsed
+	ErrInvalidScopes = echo.NewHTTPError(http.StatusBadRequest, "Scopes must be a comma separated list of ingest, read and admin")
+	// ErrKeyStoreFailure is thrown when there is an error storing a new Key in the DB
+	ErrKeyStoreFailure = echo.NewHTTPError(http.StatusInternalServerError, "Failed to store new Key in DB")
+	// ErrKeyRetrievalFailure is thrown when we fail to retrieve Keys
+	ErrKeyRetrievalFailure = echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve Keys")
+	// ErrKeyNotFound is thrown when a requested Key doesn't exist
+	ErrKeyNotFound = echo.NewHTTPError(http.StatusNotFound, "Key not found")
+	// ErrKeyRevokeFailure is thrown when we fail to revoke a Key
+	ErrKeyRevokeFailure = echo.NewHTTPError(http.StatusInternalServerError, "Failed to revoke Key")
+)
+
+// scopes contains every scope a Key may be granted
+var scopes = map[string]bool{
+	models.ScopeIngest: true,
+	models.ScopeRead:   true,
+	models.ScopeAdmin:  true,
+}
+
+// Key is a named, revocable credential of an App limited to a set of
+// scopes. Only a salted hash of its secret is stored
+type Key struct {
+	ID        string    `gorm:"type:varchar(10);primary_key"`
+	AppID     string    `gorm:"type:varchar(10);index;not null"`
+	Name      string    `gorm:"type:varchar(100);not null"`
+	Scopes    string    `gorm:"type:varchar(50);not null"` // Comma separated
+	Salt      string    `gorm:"type:varchar(32);not null"`
+	Hash      string    `gorm:"type:varchar(64);not null"`
+	CreatedAt time.Time `gorm:"not null"`
+	RevokedAt *time.Time
+}
+
+// model returns the Key as it's returned by the API. The token is
+// only included when passed, which is only done at creation
+func (k *Key) model(token string) models.Key {
+	return models.Key{ID: k.ID, Name: k.Name, Scopes: strings.Split(k.Scopes, ","),
+		Token: token, CreatedAt: k.CreatedAt, RevokedAt: k.RevokedAt}
+}
+
+// hasScope reports whether the Key was granted the passed scope
+func (k *Key) hasScope(scope string) bool {
+	for _, granted := range strings.Split(k.Scopes, ",") {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// validSecret reports whether the passed secret matches the Keys hash
+func (k *Key) validSecret(secret string) bool {
+	return k.RevokedAt == nil && equalTokens(hashToken(k.Salt, secret), k.Hash)
+}
+
+// CreateKey creates a new Key for an App granted the passed scopes.
+// The returned token is made up of the Keys ID and secret and is
+// never returned again
+// Endpoint: /app/:app_id/keys/create/:name?scopes=:scopes
+func (s *Service) CreateKey(c echo.Context) error {
+	l := s.logger.WithField("method", "create_key")
+	l.Debug("Received new CreateKey request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	name := c.Param("name")
+	l = l.WithFields(map[string]interface{}{"app_id": appID, "name": name})
+
+	// Verify the requested name and scopes
+	if name == "" || len(name) > maxKeyNameLength {
+		l.Error("Invalid Key name requested")
+		return ErrInvalidKeyName
+	}
+	granted, err := parseScopes(c.QueryParam("scopes"))
+	if err != nil {
+		l.WithError(err).Error("Failed to parse scopes")
+		return err
+	}
+	l = l.WithField("scopes", granted)
+
+	// Generate the Key and its secret
+	l.Debug("Generating new Key")
+	secret, salt := newUUID(), newUUID()
+	key := &Key{
+		ID:        newKeyID(),
+		AppID:     appID,
+		Name:      name,
+		Scopes:    granted,
+		Salt:      salt,
+		Hash:      hashToken(salt, secret),
+		CreatedAt: time.Now(),
+	}
+	l = l.WithField("key_id", key.ID)
+
+	// Insert the new Key in the DB
+	l.Debug("Storing new Key in DB")
+	if err := s.store.CreateKey(key); err != nil {
+		l.WithError(err).Error("Failed to create new Key in DB")
+		return ErrKeyStoreFailure
+	}
+
+	// Report the successful create-key to ourselves
+	go client.CreateAction("create-key")
+
+	// Return the new Key along with its token
+	l.Debug("Returning newly generated/stored Key")
+	return c.JSON(http.StatusOK, key.model(key.ID+keyTokenSeparator+secret))
+}
+
+// ListKeys retrieves every Key of an App, including revoked Keys.
+// Tokens are never returned
+// Endpoint: /app/:app_id/keys
+func (s *Service) ListKeys(c echo.Context) error {
+	l := s.logger.WithField("method", "list_keys")
+	l.Debug("Received new ListKeys request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	l = l.WithField("app_id", appID)
+
+	// Retrieve the Keys from the DB
+	l.Debug("Retrieving Keys from DB")
+	keys, err := s.store.ListKeys(appID)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve Keys")
+		return ErrKeyRetrievalFailure
+	}
+	out := make([]models.Key, len(keys))
+	for i, key := range keys {
+		out[i] = key.model("")
+	}
+
+	// Report the successful list-keys to ourselves
+	go client.CreateAction("list-keys")
+
+	// Return an Status OK
+	l.Debug("Returning successful ListKeys response")
+	return c.JSON(http.StatusOK, out)
+}
+
+// RevokeKey permanently revokes a Key of an App. Other servers may
+// continue to accept it for up to a minute
+// Endpoint: /app/:app_id/keys/:key_id
+func (s *Service) RevokeKey(c echo.Context) error {
+	l := s.logger.WithField("method", "revoke_key")
+	l.Debug("Received new RevokeKey request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	keyID := c.Param("key_id")
+	l = l.WithFields(map[string]interface{}{"app_id": appID, "key_id": keyID})
+
+	// Retrieve the Key from the DB and verify it belongs to the App
+	l.Debug("Retrieving Key from DB")
+	key, err := s.store.GetKey(keyID)
+	if err == ErrNotFound || (err == nil && key.AppID != appID) {
+		l.WithError(ErrKeyNotFound).Error("Failed to find Key")
+		return ErrKeyNotFound
+	}
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve Key")
+		return ErrKeyRetrievalFailure
+	}
+
+	// Revoke the Key if it isn't already
+	if key.RevokedAt == nil {
+		l.Debug("Revoking Key")
+		revokedAt := time.Now()
+		key.RevokedAt = &revokedAt
+		if err := s.store.UpdateKey(key); err != nil {
+			l.WithError(err).Error("Failed to revoke Key")
+			return ErrKeyRevokeFailure
+		}
+	}
+	s.cache.Delete(keyCacheKey(keyID))
+
+	// Report the successful revoke-key to ourselves
+	go client.CreateAction("revoke-key")
+
+	// Return the revoked Key
+	l.Debug("Returning successful RevokeKey response")
+	return c.JSON(http.StatusOK, key.model(""))
+}
+
+// parseScopes parses a comma separated list of scopes into its
+// canonical form, sorted the same as they were passed without duplicates
+func parseScopes(value string) (string, error) {
+	var granted []string
+	seen := make(map[string]bool)
+	for _, scope := range strings.Split(value, ",") {
+		if !scopes[scope] {
+			return "", ErrInvalidScopes
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			granted = append(granted, scope)
+		}
+	}
+	return strings.Join(granted, ","), nil
+}
+
+// getKey retrieves a Key from the cache, falling back to the DB and
+// caching it briefly if it couldn't be found. Keys that don't exist
+// are cached as well so unknown Key tokens can't cause unlimited DB
+// reads
+func (s *Service) getKey(keyID string) (*Key, error) {
+	if keyIface, ok := s.cache.Get(keyCacheKey(keyID)); ok {
+		if keyIface.(*Key) == nil {
+			return nil, ErrNotFound
+		}
+		return keyIface.(*Key), nil
+	}
+	key, err := s.store.GetKey(keyID)
+	if err == ErrNotFound {
+		s.cache.Set(keyCacheKey(keyID), (*Key)(nil), reloadInterval)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Set(keyCacheKey(keyID), key, keyCacheExp)
+	return key, nil
+}
+
+// keyCacheKey returns the cache key of a Key, which can't collide
+// with the AppIDs Apps are cached under
+func keyCacheKey(keyID string) string {
+	return "key_" + keyID
+}
+
+// splitKeyToken splits a Key token into its ID and secret, reporting
+// false if the token isn't a Key token (ex: an Apps token)
+func splitKeyToken(token string) (string, string, bool) {
+	parts := strings.SplitN(token, keyTokenSeparator, 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// hashToken returns the hex encoded SHA-256 of the salted token. As
+// tokens are randomly generated a slow hash isn't needed
+func hashToken(salt, token string) string {
+	sum := sha256.Sum256([]byte(salt + token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newKeyID generates the first part of a new V4 UUID
+func newKeyID() string {
+	return newUUID()[0:10]
+}
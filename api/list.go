@@ -0,0 +1,191 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/sdwolfe32/tinystat/client"
+)
+
+const (
+	// defaultPageLimit is the number of results returned by ListActions
+	// when no limit is passed
+	defaultPageLimit = 100
+	// defaultTopLimit is the number of results returned by TopActions
+	// when no limit is passed
+	defaultTopLimit = 10
+	// maxPageLimit is the maximum number of results returned by
+	// paginated endpoints
+	maxPageLimit = 1000
+)
+
+var (
+	// ErrInvalidPagination is thrown when a limit or offset can't be parsed
+	ErrInvalidPagination = echo.NewHTTPError(http.StatusBadRequest, "Limit must be 1-1000 and offset must not be negative")
+	// ErrListActionsFailure is thrown when we fail to list an Apps actions
+	ErrListActionsFailure = echo.NewHTTPError(http.StatusInternalServerError, "Failed to list Actions")
+	// ErrTopActionsFailure is thrown when we fail to rank an Apps actions
+	ErrTopActionsFailure = echo.NewHTTPError(http.StatusInternalServerError, "Failed to rank Actions")
+)
+
+// ListActions retrieves every distinct action of an app ordered by
+// name along with its all-time total and the start of the first and
+// last buckets it was seen in. Only actions starting with prefix are
+// listed if it's passed. Limit defaults to 100 and may be at most 1000
+// Endpoint: /app/:app_id/actions?prefix=:prefix&limit=:limit&offset=:offset
+func (s *Service) ListActions(c echo.Context) error {
+	l := s.logger.WithField("method", "list_actions")
+	l.Debug("Received new ListActions request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	prefix := c.QueryParam("prefix")
+	limit, offset, err := parsePagination(c, defaultPageLimit)
+	if err != nil {
+		l.WithError(err).Error("Failed to parse pagination")
+		return err
+	}
+	l = l.WithFields(map[string]interface{}{"app_id": appID,
+		"prefix": prefix, "limit": limit, "offset": offset})
+
+	// Retrieve the action totals from the DB and return
+	l.Debug("Retrieve the Action totals from the DB")
+	totals, err := s.store.ListActions(ActionFilter{AppID: appID, Prefix: prefix}, limit, offset)
+	if err != nil {
+		l.WithError(err).Error("Failed to list Actions")
+		return ErrListActionsFailure
+	}
+
+	// Report the successful list-actions to ourselves
+	go client.CreateAction("list-actions")
+
+	// Return an Status OK
+	l.Debug("Returning successful ListActions response")
+	return c.JSON(http.StatusOK, totals)
+}
+
+// TopActions ranks the actions of an app by their total count in the
+// passed duration, highest first. Duration should match the same
+// formatting as https://golang.org/pkg/time/#ParseDuration. Prefix,
+// limit and offset behave the same as in ListActions except that
+// limit defaults to 10
+// Endpoint: /app/:app_id/actions/top/:duration?prefix=:prefix&limit=:limit&offset=:offset
+func (s *Service) TopActions(c echo.Context) error {
+	l := s.logger.WithField("method", "top_actions")
+	l.Debug("Received new TopActions request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	duration := c.Param("duration")
+	prefix := c.QueryParam("prefix")
+	limit, offset, err := parsePagination(c, defaultTopLimit)
+	if err != nil {
+		l.WithError(err).Error("Failed to parse pagination")
+		return err
+	}
+	l = l.WithFields(map[string]interface{}{"app_id": appID, "duration": duration,
+		"prefix": prefix, "limit": limit, "offset": offset})
+
+	// Parse the duration passed
+	l.Debug("Parsing the requested duration")
+	dur, err := time.ParseDuration(duration)
+	if err != nil {
+		l.WithError(err).Error("Failed to parse duration")
+		return ErrParseDurationFailure
+	}
+
+	// Retrieve the App to determine its bucket resolution
+	app, err := s.requestApp(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return ErrAppRetrievalFailure
+	}
+
+	// Retrieve the ranked action totals from the DB and return
+	l.Debug("Retrieve the ranked Action totals from the DB")
+	totals, err := s.store.TopActions(ActionFilter{AppID: appID, Prefix: prefix,
+		Start: s.bucketStart(app, time.Now().Add(-1*dur))}, limit, offset)
+	if err != nil {
+		l.WithError(err).Error("Failed to rank Actions")
+		return ErrTopActionsFailure
+	}
+
+	// Report the successful top-actions to ourselves
+	go client.CreateAction("top-actions")
+
+	// Return an Status OK
+	l.Debug("Returning successful TopActions response")
+	return c.JSON(http.StatusOK, totals)
+}
+
+// TopActionsRange ranks the actions of an app by their total count
+// between two absolute times, highest first. Times behave the same as
+// in ActionRangeCount and everything else the same as in TopActions
+// Endpoint: /app/:app_id/actions/top?from=:from&to=:to&prefix=:prefix&limit=:limit&offset=:offset
+func (s *Service) TopActionsRange(c echo.Context) error {
+	l := s.logger.WithField("method", "top_actions_range")
+	l.Debug("Received new TopActionsRange request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	prefix := c.QueryParam("prefix")
+	limit, offset, err := parsePagination(c, defaultTopLimit)
+	if err != nil {
+		l.WithError(err).Error("Failed to parse pagination")
+		return err
+	}
+	l = l.WithFields(map[string]interface{}{"app_id": appID,
+		"prefix": prefix, "limit": limit, "offset": offset})
+
+	// Parse the requested time range
+	l.Debug("Parsing the requested time range")
+	from, to, err := parseTimeRange(c, nil)
+	if err != nil {
+		l.WithError(err).Error("Failed to parse time range")
+		return err
+	}
+	l = l.WithFields(map[string]interface{}{"from": from, "to": to})
+
+	// Retrieve the App to determine its bucket resolution
+	app, err := s.requestApp(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return ErrAppRetrievalFailure
+	}
+
+	// Retrieve the ranked action totals from the DB and return
+	l.Debug("Retrieve the ranked Action totals from the DB")
+	totals, err := s.store.TopActions(ActionFilter{AppID: appID, Prefix: prefix,
+		Start: s.bucketStart(app, from), End: to}, limit, offset)
+	if err != nil {
+		l.WithError(err).Error("Failed to rank Actions")
+		return ErrTopActionsFailure
+	}
+
+	// Report the successful top-actions-range to ourselves
+	go client.CreateAction("top-actions-range")
+
+	// Return an Status OK
+	l.Debug("Returning successful TopActionsRange response")
+	return c.JSON(http.StatusOK, totals)
+}
+
+// parsePagination parses the limit and offset query params of a
+// request, defaulting to the first page of defaultLimit results
+func parsePagination(c echo.Context, defaultLimit int) (int, int, error) {
+	limit, offset := defaultLimit, 0
+	var err error
+	if value := c.QueryParam("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxPageLimit {
+			return 0, 0, ErrInvalidPagination
+		}
+	}
+	if value := c.QueryParam("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			return 0, 0, ErrInvalidPagination
+		}
+	}
+	return limit, offset, nil
+}
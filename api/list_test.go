@@ -0,0 +1,140 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+func TestListActions(t *testing.T) {
+	s, e := newTestService(t)
+	app := createTestApp(t, e, "")
+	other := createTestApp(t, e, "")
+
+	// Seed actions of the App and of another App
+	day := time.Date(2018, time.January, 2, 0, 0, 0, 0, time.UTC)
+	for _, seed := range []struct {
+		appID, action string
+		hours, count  int
+	}{
+		{app.ID, "signup", 0, 2},
+		{app.ID, "signup", 2, 3},
+		{app.ID, "login", 1, 1},
+		{app.ID, "logout", 3, 7},
+		{other.ID, "checkout", 0, 1},
+	} {
+		if err := s.store.IncrementAction(seed.appID, seed.action, nil, seed.count,
+			day.Add(time.Duration(seed.hours)*time.Hour)); err != nil {
+			t.Fatalf("Failed to seed Actions: %v", err)
+		}
+	}
+	path := fmt.Sprintf("/v1/app/%s/actions", app.ID)
+
+	// Every action of the App is listed by name with its total
+	var totals []models.ActionTotal
+	if code := testRequest(t, e, http.MethodGet, path, "", nil, &totals); code != http.StatusOK {
+		t.Fatalf("Expected ListActions to return 200, got %d", code)
+	}
+	expected := []models.ActionTotal{
+		{Action: "login", Total: 1, FirstSeen: day.Add(time.Hour), LastSeen: day.Add(time.Hour)},
+		{Action: "logout", Total: 7, FirstSeen: day.Add(3 * time.Hour), LastSeen: day.Add(3 * time.Hour)},
+		{Action: "signup", Total: 5, FirstSeen: day, LastSeen: day.Add(2 * time.Hour)},
+	}
+	if len(totals) != len(expected) {
+		t.Fatalf("Expected %d actions, got %+v", len(expected), totals)
+	}
+	for i, total := range totals {
+		if total.Action != expected[i].Action || total.Total != expected[i].Total ||
+			!total.FirstSeen.Equal(expected[i].FirstSeen) || !total.LastSeen.Equal(expected[i].LastSeen) {
+			t.Errorf("Expected action %d to be %+v, got %+v", i, expected[i], total)
+		}
+	}
+
+	// Actions are filtered by prefix and paginated
+	for query, actions := range map[string][]string{
+		"?prefix=log":        {"login", "logout"},
+		"?limit=1&offset=1":  {"logout"},
+		"?prefix=x":          {},
+		"?limit=2&offset=10": {},
+	} {
+		totals = nil
+		if code := testRequest(t, e, http.MethodGet, path+query, "", nil, &totals); code != http.StatusOK {
+			t.Fatalf("Expected GET %s to return 200, got %d", path+query, code)
+		}
+		if len(totals) != len(actions) {
+			t.Errorf("Expected GET %s to list %v, got %+v", path+query, actions, totals)
+			continue
+		}
+		for i, total := range totals {
+			if total.Action != actions[i] {
+				t.Errorf("Expected GET %s to list %v, got %+v", path+query, actions, totals)
+			}
+		}
+	}
+
+	// Invalid pagination is rejected
+	for _, query := range []string{"?limit=0", "?limit=1001", "?limit=many", "?offset=-1"} {
+		if code := testRequest(t, e, http.MethodGet, path+query, "", nil, nil); code != http.StatusBadRequest {
+			t.Errorf("Expected GET %s to return 400, got %d", path+query, code)
+		}
+	}
+}
+
+func TestTopActions(t *testing.T) {
+	s, e := newTestService(t)
+	app := createTestApp(t, e, "")
+
+	// Seed recent actions and actions of a day long ago
+	now := app.bucket(time.Now())
+	day := time.Date(2018, time.January, 2, 0, 0, 0, 0, time.UTC)
+	for _, seed := range []struct {
+		action    string
+		timestamp time.Time
+		count     int
+	}{
+		{"search", now, 9},
+		{"signup", now, 4},
+		{"signup", day, 5},
+		{"login", day.Add(time.Hour), 1},
+		{"logout", day.Add(30 * time.Hour), 7},
+	} {
+		if err := s.store.IncrementAction(app.ID, seed.action, nil, seed.count, seed.timestamp); err != nil {
+			t.Fatalf("Failed to seed Actions: %v", err)
+		}
+	}
+	rangeQuery := fmt.Sprintf("?from=%d&to=%d", day.Unix(), day.Add(24*time.Hour).Unix())
+	path := fmt.Sprintf("/v1/app/%s/actions/top", app.ID)
+
+	// Actions are ranked by their total within the duration or range
+	for query, expected := range map[string][]models.ActionTotal{
+		"/1h":                      {{Action: "search", Total: 9}, {Action: "signup", Total: 4}},
+		"/1h?limit=1&offset=1":     {{Action: "signup", Total: 4}},
+		rangeQuery:                 {{Action: "signup", Total: 5}, {Action: "login", Total: 1}},
+		rangeQuery + "&prefix=log": {{Action: "login", Total: 1}},
+		rangeQuery + "&offset=2":   {},
+	} {
+		var totals []models.ActionTotal
+		if code := testRequest(t, e, http.MethodGet, path+query, "", nil, &totals); code != http.StatusOK {
+			t.Fatalf("Expected GET %s to return 200, got %d", path+query, code)
+		}
+		if len(totals) != len(expected) {
+			t.Errorf("Expected GET %s to rank %+v, got %+v", path+query, expected, totals)
+			continue
+		}
+		for i, total := range totals {
+			if total.Action != expected[i].Action || total.Total != expected[i].Total {
+				t.Errorf("Expected GET %s to rank %+v, got %+v", path+query, expected, totals)
+			}
+		}
+	}
+
+	// Invalid durations, ranges and pagination are rejected
+	for _, query := range []string{"/forever", "/1h?limit=0", "?from=soon", rangeQuery + "&offset=-1"} {
+		if code := testRequest(t, e, http.MethodGet, path+query, "", nil, nil); code != http.StatusBadRequest {
+			t.Errorf("Expected GET %s to return 400, got %d", path+query, code)
+		}
+	}
+}
@@ -0,0 +1,684 @@
+package api
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sdwolfe32/tinystat/models"
+	"github.com/sdwolfe32/tinystat/sketch"
+)
+
+// memoryStore is a Store that keeps all buckets and Apps in memory.
+// It is intended for tests and ephemeral development servers
+type memoryStore struct {
+	sync.RWMutex
+	actions map[string]*Action       // generateKey -> hour bucket
+	uniques map[string]*Unique       // generateKey -> hour bucket
+	gauges  map[string]*Gauge        // generateKey -> hour bucket
+	dists   map[string]*Distribution // generateKey -> hour bucket
+	apps    map[string]*App          // appID -> App
+	keys    map[string]*Key          // keyID -> Key
+	rollups map[string]*RollupState  // interval -> RollupState
+}
+
+// NewMemoryStore generates a new empty in-memory Store
+func NewMemoryStore() Store {
+	return &memoryStore{
+		actions: make(map[string]*Action),
+		uniques: make(map[string]*Unique),
+		gauges:  make(map[string]*Gauge),
+		dists:   make(map[string]*Distribution),
+		apps:    make(map[string]*App),
+		keys:    make(map[string]*Key),
+		rollups: make(map[string]*RollupState),
+	}
+}
+
+// IncrementAction adds count to the bucket for the passed tags
+// and timestamp
+func (m *memoryStore) IncrementAction(appID, action string, tags models.Tags, count int, timestamp time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.increment(appID, ActionIncrement{Action: action, Tags: tags,
+		Count: int64(count), Timestamp: timestamp})
+	return nil
+}
+
+// IncrementActions applies every increment while holding the lock
+func (m *memoryStore) IncrementActions(appID string, increments []ActionIncrement) error {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, inc := range increments {
+		m.increment(appID, inc)
+	}
+	return nil
+}
+
+// increment adds the count of an increment to its bucket. The
+// memoryStore must be locked by the caller
+func (m *memoryStore) increment(appID string, inc ActionIncrement) {
+	key := generateKey(appID, inc.Action, inc.Tags.String(), inc.Timestamp)
+	if a, ok := m.actions[key]; ok {
+		a.Count += inc.Count
+		return
+	}
+	m.actions[key] = &Action{
+		ID:        key,
+		AppID:     appID,
+		Action:    inc.Action,
+		Tags:      inc.Tags.String(),
+		Count:     inc.Count,
+		Timestamp: inc.Timestamp.UTC(),
+	}
+}
+
+// SumActions sums the counts of all buckets matching the filter
+func (m *memoryStore) SumActions(filter ActionFilter) (int64, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	var total int64
+	for _, a := range m.actions {
+		if filter.matches(a) {
+			total += a.Count
+		}
+	}
+	return total, nil
+}
+
+// SumActionBuckets returns the count of every bucket matching the
+// filter. Buckets are already unique by timestamp and tags
+func (m *memoryStore) SumActionBuckets(filter ActionFilter) ([]BucketResult, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	var res []BucketResult
+	for _, a := range m.actions {
+		if filter.matches(a) {
+			res = append(res, BucketResult{Timestamp: a.Timestamp, Tags: a.Tags, Total: a.Count})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Timestamp.Before(res[j].Timestamp) })
+	return res, nil
+}
+
+// SumActionTags sums the counts of all buckets matching the
+// filter grouped by their tags
+func (m *memoryStore) SumActionTags(filter ActionFilter) ([]TagsResult, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	totals := make(map[string]int64)
+	for _, a := range m.actions {
+		if filter.matches(a) {
+			totals[a.Tags] += a.Count
+		}
+	}
+	res := make([]TagsResult, 0, len(totals))
+	for tags, total := range totals {
+		res = append(res, TagsResult{Tags: tags, Total: total})
+	}
+	return res, nil
+}
+
+// ListActions totals the buckets matching the filter by action
+// ordered by name
+func (m *memoryStore) ListActions(filter ActionFilter, limit, offset int) ([]models.ActionTotal, error) {
+	totals := m.actionTotals(filter)
+	sort.Slice(totals, func(i, j int) bool { return totals[i].Action < totals[j].Action })
+	return paginate(totals, limit, offset), nil
+}
+
+// TopActions totals the buckets matching the filter by action
+// ordered by total
+func (m *memoryStore) TopActions(filter ActionFilter, limit, offset int) ([]models.ActionTotal, error) {
+	totals := m.actionTotals(filter)
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].Total != totals[j].Total {
+			return totals[i].Total > totals[j].Total
+		}
+		return totals[i].Action < totals[j].Action
+	})
+	return paginate(totals, limit, offset), nil
+}
+
+// actionTotals totals the buckets matching the filter by action,
+// ignoring tags
+func (m *memoryStore) actionTotals(filter ActionFilter) []models.ActionTotal {
+	m.RLock()
+	defer m.RUnlock()
+
+	filter.Tags = nil
+	byAction := make(map[string]*models.ActionTotal)
+	for _, a := range m.actions {
+		if !filter.matches(a) {
+			continue
+		}
+		t, ok := byAction[a.Action]
+		if !ok {
+			t = &models.ActionTotal{Action: a.Action,
+				FirstSeen: a.Timestamp, LastSeen: a.Timestamp}
+			byAction[a.Action] = t
+		}
+		t.Total += a.Count
+		if a.Timestamp.Before(t.FirstSeen) {
+			t.FirstSeen = a.Timestamp
+		}
+		if a.Timestamp.After(t.LastSeen) {
+			t.LastSeen = a.Timestamp
+		}
+	}
+
+	totals := make([]models.ActionTotal, 0, len(byAction))
+	for _, t := range byAction {
+		totals = append(totals, *t)
+	}
+	return totals
+}
+
+// OldestBucket returns the timestamp of the oldest bucket of any
+// metric type
+func (m *memoryStore) OldestBucket() (time.Time, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	var oldest time.Time
+	older := func(t time.Time) {
+		if oldest.IsZero() || t.Before(oldest) {
+			oldest = t
+		}
+	}
+	for _, a := range m.actions {
+		older(a.Timestamp)
+	}
+	for _, u := range m.uniques {
+		older(u.Timestamp)
+	}
+	for _, g := range m.gauges {
+		older(g.Timestamp)
+	}
+	for _, d := range m.dists {
+		older(d.Timestamp)
+	}
+	return oldest, nil
+}
+
+// RollupActions merges all buckets of each app, action and set of
+// tags within [start, end) into a single bucket timestamped at start
+func (m *memoryStore) RollupActions(start, end time.Time) (int64, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	// Group the keys of every bucket in range by app, action and tags
+	filter := ActionFilter{Start: start, End: end}
+	groups := make(map[[3]string][]string)
+	for key, a := range m.actions {
+		if filter.matches(a) {
+			group := [3]string{a.AppID, a.Action, a.Tags}
+			groups[group] = append(groups[group], key)
+		}
+	}
+
+	// Replace the buckets of every group with their total
+	var removed int64
+	for group, keys := range groups {
+		if len(keys) < 2 {
+			continue
+		}
+		var total int64
+		for _, key := range keys {
+			total += m.actions[key].Count
+			delete(m.actions, key)
+		}
+		key := generateKey(group[0], group[1], group[2], start)
+		m.actions[key] = &Action{
+			ID:        key,
+			AppID:     group[0],
+			Action:    group[1],
+			Tags:      group[2],
+			Count:     total,
+			Timestamp: start.UTC(),
+		}
+		removed += int64(len(keys) - 1)
+	}
+
+	// Replace the unique buckets of every app and action with
+	// their merged sketch
+	var uniques []*Unique
+	for _, u := range m.uniques {
+		if filter.matchesBucket(u.AppID, u.Action, u.Timestamp) {
+			uniques = append(uniques, u)
+		}
+	}
+	merged, err := rollupUniques(uniques, start)
+	if err != nil {
+		return removed, err
+	}
+	for _, mu := range merged {
+		for key, u := range m.uniques {
+			if u.AppID == mu.AppID && u.Action == mu.Action &&
+				filter.matchesBucket(u.AppID, u.Action, u.Timestamp) {
+				delete(m.uniques, key)
+				removed++
+			}
+		}
+		m.uniques[mu.ID] = mu
+		removed--
+	}
+
+	// Replace the gauge buckets of every app and name with their
+	// merged samples
+	var gauges []*Gauge
+	for _, g := range m.gauges {
+		if filter.matchesBucket(g.AppID, g.Name, g.Timestamp) {
+			gauges = append(gauges, g)
+		}
+	}
+	for _, mg := range rollupGauges(gauges, start) {
+		for key, g := range m.gauges {
+			if g.AppID == mg.AppID && g.Name == mg.Name &&
+				filter.matchesBucket(g.AppID, g.Name, g.Timestamp) {
+				delete(m.gauges, key)
+				removed++
+			}
+		}
+		m.gauges[mg.ID] = mg
+		removed--
+	}
+
+	// Replace the distribution buckets of every app and action with
+	// their merged histogram
+	var dists []*Distribution
+	for _, d := range m.dists {
+		if filter.matchesBucket(d.AppID, d.Action, d.Timestamp) {
+			dists = append(dists, d)
+		}
+	}
+	mergedDists, err := rollupDistributions(dists, start)
+	if err != nil {
+		return removed, err
+	}
+	for _, md := range mergedDists {
+		for key, d := range m.dists {
+			if d.AppID == md.AppID && d.Action == md.Action &&
+				filter.matchesBucket(d.AppID, d.Action, d.Timestamp) {
+				delete(m.dists, key)
+				removed++
+			}
+		}
+		m.dists[md.ID] = md
+		removed--
+	}
+	return removed, nil
+}
+
+// PurgeActions deletes at most limit buckets of each metric type of
+// the passed app with timestamps before the passed time
+func (m *memoryStore) PurgeActions(appID string, before time.Time, limit int) (int64, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	var actions, uniques, gauges, dists int64
+	for key, a := range m.actions {
+		if actions >= int64(limit) {
+			break
+		}
+		if a.AppID == appID && a.Timestamp.Before(before) {
+			delete(m.actions, key)
+			actions++
+		}
+	}
+	for key, u := range m.uniques {
+		if uniques >= int64(limit) {
+			break
+		}
+		if u.AppID == appID && u.Timestamp.Before(before) {
+			delete(m.uniques, key)
+			uniques++
+		}
+	}
+	for key, g := range m.gauges {
+		if gauges >= int64(limit) {
+			break
+		}
+		if g.AppID == appID && g.Timestamp.Before(before) {
+			delete(m.gauges, key)
+			gauges++
+		}
+	}
+	for key, d := range m.dists {
+		if dists >= int64(limit) {
+			break
+		}
+		if d.AppID == appID && d.Timestamp.Before(before) {
+			delete(m.dists, key)
+			dists++
+		}
+	}
+	return actions + uniques + gauges + dists, nil
+}
+
+// GetRollupState returns a copy of the progress of a rollup level
+func (m *memoryStore) GetRollupState(interval string) (*RollupState, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	if state, ok := m.rollups[interval]; ok {
+		copied := *state
+		return &copied, nil
+	}
+	return &RollupState{Name: interval}, nil
+}
+
+// SetRollupRolled updates the rolled mark of a rollup level
+func (m *memoryStore) SetRollupRolled(interval string, rolled time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+
+	rolled = rolled.UTC()
+	m.rollupState(interval).Rolled = &rolled
+	return nil
+}
+
+// MarkRollupPending lowers the pending interval of a rollup level
+func (m *memoryStore) MarkRollupPending(interval string, start time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+
+	start = start.UTC()
+	if state := m.rollupState(interval); state.Pending == nil || start.Before(*state.Pending) {
+		state.Pending = &start
+	}
+	return nil
+}
+
+// ClearRollupPending clears the pending interval of a rollup level if
+// it hasn't changed
+func (m *memoryStore) ClearRollupPending(interval string, pending time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if state := m.rollupState(interval); state.Pending != nil && state.Pending.Equal(pending) {
+		state.Pending = nil
+	}
+	return nil
+}
+
+// rollupState returns the stored state of a rollup level, creating it
+// if it doesn't exist. The memoryStore must be locked by the caller
+func (m *memoryStore) rollupState(interval string) *RollupState {
+	state, ok := m.rollups[interval]
+	if !ok {
+		state = &RollupState{Name: interval}
+		m.rollups[interval] = state
+	}
+	return state
+}
+
+// MergeUnique merges the HLL into the bucket for the passed timestamp
+func (m *memoryStore) MergeUnique(appID, action string, hll *sketch.HLL, timestamp time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := generateKey(appID, action, "", timestamp)
+	u, ok := m.uniques[key]
+	if !ok {
+		u = &Unique{ID: key, AppID: appID, Action: action, Timestamp: timestamp.UTC()}
+	}
+	if err := u.merge(hll); err != nil {
+		return err
+	}
+	m.uniques[key] = u
+	return nil
+}
+
+// UniqueSketch merges the sketches of all buckets matching the filter
+func (m *memoryStore) UniqueSketch(filter ActionFilter) (*sketch.HLL, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	var uniques []*Unique
+	for _, u := range m.uniques {
+		if filter.matchesBucket(u.AppID, u.Action, u.Timestamp) {
+			uniques = append(uniques, u)
+		}
+	}
+	return mergeUniques(uniques)
+}
+
+// RecordGauge merges the samples into the bucket for the passed
+// timestamp
+func (m *memoryStore) RecordGauge(appID, name string, samples models.Gauge, timestamp time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := generateKey(appID, name, "", timestamp)
+	g, ok := m.gauges[key]
+	if !ok {
+		g = &Gauge{ID: key, AppID: appID, Name: name, Timestamp: timestamp.UTC()}
+		m.gauges[key] = g
+	}
+	g.merge(samples)
+	return nil
+}
+
+// AggregateGauge merges the samples of all buckets matching the filter
+func (m *memoryStore) AggregateGauge(filter ActionFilter) (models.Gauge, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	var res models.Gauge
+	for _, g := range m.gauges {
+		if filter.matchesBucket(g.AppID, g.Name, g.Timestamp) {
+			res.Merge(g.value())
+		}
+	}
+	return res, nil
+}
+
+// MergeDistribution merges the Histogram into the bucket for the
+// passed timestamp
+func (m *memoryStore) MergeDistribution(appID, action string, hist *sketch.Histogram, timestamp time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := generateKey(appID, action, "", timestamp)
+	d, ok := m.dists[key]
+	if !ok {
+		d = &Distribution{ID: key, AppID: appID, Action: action, Timestamp: timestamp.UTC()}
+	}
+	if err := d.merge(hist); err != nil {
+		return err
+	}
+	m.dists[key] = d
+	return nil
+}
+
+// DistributionSketch merges the histograms of all buckets matching
+// the filter
+func (m *memoryStore) DistributionSketch(filter ActionFilter) (*sketch.Histogram, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	var dists []*Distribution
+	for _, d := range m.dists {
+		if filter.matchesBucket(d.AppID, d.Action, d.Timestamp) {
+			dists = append(dists, d)
+		}
+	}
+	return mergeDistributions(dists)
+}
+
+// CreateApp stores a copy of the passed App
+func (m *memoryStore) CreateApp(app *App) error {
+	m.Lock()
+	defer m.Unlock()
+
+	stored := *app
+	m.apps[app.ID] = &stored
+	return nil
+}
+
+// GetApp returns a copy of the App with the passed ID
+func (m *memoryStore) GetApp(appID string) (*App, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	app, ok := m.apps[appID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *app
+	return &found, nil
+}
+
+// UpdateApp replaces the stored App with a copy of the passed one
+func (m *memoryStore) UpdateApp(app *App) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.apps[app.ID]; !ok {
+		return ErrNotFound
+	}
+	stored := *app
+	m.apps[app.ID] = &stored
+	return nil
+}
+
+// ListApps returns a copy of every App
+func (m *memoryStore) ListApps() ([]*App, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	apps := make([]*App, 0, len(m.apps))
+	for _, app := range m.apps {
+		found := *app
+		apps = append(apps, &found)
+	}
+	return apps, nil
+}
+
+// DeleteApp removes an App, all of its buckets and all of its Keys
+func (m *memoryStore) DeleteApp(appID string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	for key, a := range m.actions {
+		if a.AppID == appID {
+			delete(m.actions, key)
+		}
+	}
+	for key, u := range m.uniques {
+		if u.AppID == appID {
+			delete(m.uniques, key)
+		}
+	}
+	for key, g := range m.gauges {
+		if g.AppID == appID {
+			delete(m.gauges, key)
+		}
+	}
+	for key, d := range m.dists {
+		if d.AppID == appID {
+			delete(m.dists, key)
+		}
+	}
+	for id, k := range m.keys {
+		if k.AppID == appID {
+			delete(m.keys, id)
+		}
+	}
+	delete(m.apps, appID)
+	return nil
+}
+
+// CreateKey stores a copy of the passed Key
+func (m *memoryStore) CreateKey(key *Key) error {
+	m.Lock()
+	defer m.Unlock()
+
+	stored := *key
+	m.keys[key.ID] = &stored
+	return nil
+}
+
+// GetKey returns a copy of the Key with the passed ID
+func (m *memoryStore) GetKey(keyID string) (*Key, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	key, ok := m.keys[keyID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *key
+	return &found, nil
+}
+
+// UpdateKey replaces the stored Key with a copy of the passed one
+func (m *memoryStore) UpdateKey(key *Key) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.keys[key.ID]; !ok {
+		return ErrNotFound
+	}
+	stored := *key
+	m.keys[key.ID] = &stored
+	return nil
+}
+
+// ListKeys returns a copy of every Key of the passed app ordered by
+// creation
+func (m *memoryStore) ListKeys(appID string) ([]*Key, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	var keys []*Key
+	for _, key := range m.keys {
+		if key.AppID == appID {
+			found := *key
+			keys = append(keys, &found)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+// CountApps returns the number of Apps, optionally only those
+// created by the passed IP
+func (m *memoryStore) CountApps(ip string) (int64, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	var count int64
+	for _, app := range m.apps {
+		if ip == "" || app.IP == ip {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Close is a no-op for the memoryStore
+func (m *memoryStore) Close() error { return nil }
+
+// paginate returns at most limit totals after skipping offset
+func paginate(totals []models.ActionTotal, limit, offset int) []models.ActionTotal {
+	if offset >= len(totals) {
+		return []models.ActionTotal{}
+	}
+	totals = totals[offset:]
+	if limit < len(totals) {
+		totals = totals[:limit]
+	}
+	return totals
+}
@@ -1,68 +1,221 @@
 package api
 
 import (
+	"crypto/subtle"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/labstack/echo"
+	"github.com/sdwolfe32/tinystat/models"
 )
 
-// rateLimit is the amount of time a requestor must wait before
-// making another request
-const rateLimit = time.Second * 1 // 1RPS
+const (
+	// rateLimit is the amount of time a requestor must wait before
+	// making another request
+	rateLimit = time.Second * 1 // 1RPS
+	// reloadInterval is the shortest time between DB lookups made
+	// because a token wasn't accepted, so invalid tokens can't cause
+	// unlimited DB reads
+	reloadInterval = time.Second * 5
+	// appContextKey is the echo context key TokenAuth stores the
+	// authenticated App under
+	appContextKey = "app"
+	// keyContextKey is the echo context key TokenAuth stores the
+	// authenticated Key under, if the request used one
+	keyContextKey = "key"
+)
 
 var (
 	// ErrRateLimitExceeded is thrown when an IP exceeds the specified rate limit
 	ErrRateLimitExceeded = echo.NewHTTPError(http.StatusTooManyRequests, "Rate limit exceeded (1RPS)")
 	// ErrInvalidToken is thrown when a request fails to be authenticated
 	ErrInvalidToken = echo.NewHTTPError(http.StatusUnauthorized, "Failed to validate token")
+	// ErrMissingScope is thrown when a Key isn't granted the scope required by a request
+	ErrMissingScope = echo.NewHTTPError(http.StatusForbidden, "Key isn't granted the required scope")
+	// ErrInvalidAdminToken is thrown when a request fails to be authenticated as an admin
+	ErrInvalidAdminToken = echo.NewHTTPError(http.StatusUnauthorized, "Failed to validate admin token")
+	// ErrAdminDisabled is thrown when an admin request is made but no admin token is configured
+	ErrAdminDisabled = echo.NewHTTPError(http.StatusForbidden, "App management is disabled")
 )
 
 // TokenAuth validates that the token matches the appID
 // If the strictAuth value is set to true, a token MUST be valid
 // If the strictAuth value is set to false, we'll refer to the users secure flag
+// Both the current token and a rotated token within its grace period
+// are valid, as are Keys of the App granted the ingest scope for POST
+// requests or the read scope for all other requests
 func (s *Service) TokenAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return s.tokenAuth(next, false)
+}
+
+// AppAdminAuth validates that the token matches the appID on every
+// request. The Apps current token, a rotated token within its grace
+// period and Keys of the App granted the admin scope are valid
+func (s *Service) AppAdminAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return s.tokenAuth(next, true)
+}
+
+// tokenAuth validates that the token matches the appID when required
+// and that Keys are granted the scope required by the request
+func (s *Service) tokenAuth(next echo.HandlerFunc, admin bool) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		l := s.logger.WithField("method", "validate_token")
 
 		// Pull the appID and token from the request
 		appID := c.Param("app_id")
-		var token string
-		token = c.QueryParam("token")
-		if token == "" {
-			token = c.Request().Header.Get("TOKEN")
+		token := requestToken(c)
+		l = l.WithField("app_id", appID)
+
+		// Determine the scope required by the request
+		scope := models.ScopeRead
+		switch {
+		case admin:
+			scope = models.ScopeAdmin
+		case c.Request().Method == http.MethodPost:
+			scope = models.ScopeIngest
 		}
-		l = l.WithFields(map[string]interface{}{"app_id": appID, "token": token})
-
-		// Check the cache for a stored app/token and validate
-		l.Debug("Checking cache for App")
-		var app App
-		if appIface, ok := s.cache.Get(appID); ok {
-			app = *appIface.(*App)
-		} else {
-			// Attempt to retrieve the app from the DB if it couldn't be found in cache
-			if err := s.db.Where(&App{ID: appID}).Find(&app).Error; err != nil {
-				l.WithError(err).Error("Failed to retrieve App from DB")
-				return ErrInvalidToken
-			}
-			// Cache the App for future
-			l.Debug("Storing App in Cache")
-			s.cache.SetDefault(appID, &app)
+		l = l.WithField("scope", scope)
+
+		// Retrieve the App from the cache or DB and validate
+		l.Debug("Retrieving App")
+		app, err := s.getApp(appID)
+		if err != nil {
+			l.WithError(err).Error("Failed to retrieve App")
+			return ErrInvalidToken
 		}
 
 		// If a POST request or a secure app (secure all get requests) verify token
-		if c.Request().Method == http.MethodPost || app.StrictAuth {
-			if app.Token != token {
-				l.WithError(ErrInvalidToken).Error("Failed to validate token")
-				return ErrInvalidToken
+		if scope != models.ScopeRead || app.StrictAuth {
+			if app, err = s.authenticate(c, app, token, scope); err != nil {
+				l.WithError(err).Error("Failed to validate token")
+				return err
 			}
 		}
 		// Otherwise fuck it
+		c.Set(appContextKey, app)
+		return next(c)
+	}
+}
+
+// authenticate validates the passed token against the App, returning
+// the App it was validated against. Keys are stored on the context
+// of the request once validated
+func (s *Service) authenticate(c echo.Context, app *App, token, scope string) (*App, error) {
+	// Keys are only valid for their own App and scopes
+	if keyID, secret, ok := splitKeyToken(token); ok {
+		key, err := s.getKey(keyID)
+		if err != nil || key.AppID != app.ID || !key.validSecret(secret) {
+			return nil, ErrInvalidToken
+		}
+		if !key.hasScope(scope) {
+			return nil, ErrMissingScope
+		}
+		c.Set(keyContextKey, key)
+		return app, nil
+	}
+
+	// The cached App may predate a rotation on another server, so it's
+	// reloaded unless it already was recently
+	if !app.validToken(token, time.Now()) {
+		if s.cache.Add(reloadCacheKey(app.ID), true, reloadInterval) != nil {
+			return nil, ErrInvalidToken
+		}
+		var err error
+		if app, err = s.reloadApp(app.ID); err != nil {
+			return nil, ErrInvalidToken
+		}
+	}
+	if !app.validToken(token, time.Now()) {
+		return nil, ErrInvalidToken
+	}
+	return app, nil
+}
+
+// AdminAuth validates that the ADMIN-TOKEN header matches the
+// configured admin token. If no admin token is configured every
+// request is rejected
+func (s *Service) AdminAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		l := s.logger.WithField("method", "validate_admin_token")
+
+		// Verify app management is enabled
+		if s.adminToken == "" {
+			l.WithError(ErrAdminDisabled).Error("Admin request made without an admin token configured")
+			return ErrAdminDisabled
+		}
+
+		// Compare the passed token in constant time so it can't be guessed
+		token := c.Request().Header.Get("ADMIN-TOKEN")
+		if !equalTokens(token, s.adminToken) {
+			l.WithError(ErrInvalidAdminToken).Error("Failed to validate admin token")
+			return ErrInvalidAdminToken
+		}
 		return next(c)
 	}
 }
 
+// getApp retrieves an App from the cache, falling back to the DB
+// and caching it if it couldn't be found
+func (s *Service) getApp(appID string) (*App, error) {
+	if appIface, ok := s.cache.Get(appID); ok {
+		return appIface.(*App), nil
+	}
+	app, err := s.store.GetApp(appID)
+	if err != nil {
+		return nil, err
+	}
+	s.cacheApp(app)
+	return app, nil
+}
+
+// reloadApp retrieves an App from the DB and replaces the cached App
+// with it
+func (s *Service) reloadApp(appID string) (*App, error) {
+	app, err := s.store.GetApp(appID)
+	if err != nil {
+		return nil, err
+	}
+	s.cacheApp(app)
+	return app, nil
+}
+
+// cacheApp caches an App for at most maxAppCacheExp. Changed Apps
+// are cached as well so the change applies on this server immediately
+func (s *Service) cacheApp(app *App) {
+	s.cache.Set(app.ID, app, s.appExp)
+}
+
+// reloadCacheKey returns the cache key marking an App as recently
+// reloaded, which can't collide with the AppIDs Apps are cached under
+func reloadCacheKey(appID string) string {
+	return "reload_" + appID
+}
+
+// requestToken returns the token passed with a request, either as the
+// token query param or the TOKEN header
+func requestToken(c echo.Context) string {
+	if token := c.QueryParam("token"); token != "" {
+		return token
+	}
+	return c.Request().Header.Get("TOKEN")
+}
+
+// equalTokens compares two tokens in constant time so they can't be
+// guessed one character at a time
+func equalTokens(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// requestApp returns the App authenticated by TokenAuth, retrieving
+// it by the requests app_id if TokenAuth wasn't performed
+func (s *Service) requestApp(c echo.Context) (*App, error) {
+	if app, ok := c.Get(appContextKey).(*App); ok {
+		return app, nil
+	}
+	return s.getApp(c.Param("app_id"))
+}
+
 // RateLimit returns true if the ip passed has performed too
 // many requests lately
 // vars should include the IP and any other variables to make
@@ -71,9 +224,11 @@ func (s *Service) RateLimit(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		l := s.logger.WithField("method", "rate_limit")
 
-		// Create a vars key
+		// Create a vars key. The route is included so requests to
+		// different endpoints with the same params (ex: a unique and
+		// a distribution of the same action) aren't limited together
 		var vars []string
-		vars = append(vars, c.RealIP())
+		vars = append(vars, c.RealIP(), c.Path())
 		vars = append(vars, c.ParamValues()...)
 		key := strings.Join(vars, "_")
 		l = l.WithField("key", key)
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+func TestTokenAuth(t *testing.T) {
+	_, e := newTestService(t)
+	app := createTestApp(t, e, "")
+	strict := createTestApp(t, e, "strict_auth=true")
+
+	for _, test := range []struct {
+		method, path, token string
+		code                int
+	}{
+		// Reporting actions always requires the Apps token
+		{http.MethodPost, "/v1/app/%s/action/signup/create/1", app.Token, http.StatusOK},
+		{http.MethodPost, "/v1/app/%s/action/signup/create/1", "", http.StatusUnauthorized},
+		{http.MethodPost, "/v1/app/%s/action/signup/create/1", strict.Token, http.StatusUnauthorized},
+		// Reading actions only requires it for StrictAuth Apps
+		{http.MethodGet, "/v1/app/%s/action/signup/count/1h", "", http.StatusOK},
+	} {
+		path := fmt.Sprintf(test.path, app.ID)
+		if code := testRequest(t, e, test.method, path, test.token, nil, nil); code != test.code {
+			t.Errorf("Expected %s %s to return %d, got %d", test.method, path, test.code, code)
+		}
+	}
+
+	path := fmt.Sprintf("/v1/app/%s/action/signup/count/1h", strict.ID)
+	if code := testRequest(t, e, http.MethodGet, path, "", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected an unauthenticated read of a StrictAuth App to return 401, got %d", code)
+	}
+	if code := testRequest(t, e, http.MethodGet, path, strict.Token, nil, nil); code != http.StatusOK {
+		t.Errorf("Expected an authenticated read of a StrictAuth App to return 200, got %d", code)
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	_, e := newTestService(t)
+	app := createTestApp(t, e, "")
+
+	// App management requires the admin token rather than an Apps token
+	path := fmt.Sprintf("/v1/app/%s", app.ID)
+	for token, code := range map[string]int{
+		"":             http.StatusUnauthorized,
+		app.Token:      http.StatusUnauthorized,
+		testAdminToken: http.StatusOK,
+	} {
+		if got := testRequest(t, e, http.MethodGet, path, token, nil, nil); got != code {
+			t.Errorf("Expected GET %s with token %q to return %d, got %d", path, token, code, got)
+		}
+	}
+	if code := testRequest(t, e, http.MethodPost, "/v1/app/create/test", app.Token,
+		nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected CreateApp without the admin token to return 401, got %d", code)
+	}
+
+	// The Apps token is never returned once created
+	var retrieved App
+	testRequest(t, e, http.MethodGet, path, testAdminToken, nil, &retrieved)
+	if retrieved.Token != "" || retrieved.TokenHash != "" {
+		t.Error("Expected GetApp not to return the Apps token")
+	}
+}
+
+func TestRotateToken(t *testing.T) {
+	s, e := newTestService(t)
+	app := createTestApp(t, e, "")
+	createPath := fmt.Sprintf("/v1/app/%s/action/signup/create/1", app.ID)
+
+	// The previous token remains valid during its grace period
+	var rotation models.TokenRotation
+	path := fmt.Sprintf("/v1/app/%s/token/rotate?grace=1h", app.ID)
+	if code := testRequest(t, e, http.MethodPost, path, app.Token, nil, &rotation); code != http.StatusOK {
+		t.Fatalf("Expected RotateToken to return 200, got %d", code)
+	}
+	if rotation.Token == "" || rotation.Token == app.Token || rotation.PreviousTokenExpiresAt == nil {
+		t.Fatalf("Expected a new token with a grace period, got %+v", rotation)
+	}
+	for _, token := range []string{app.Token, rotation.Token} {
+		if code := testRequest(t, e, http.MethodPost, createPath, token, nil, nil); code != http.StatusOK {
+			t.Errorf("Expected token %q to be valid, got %d", token, code)
+		}
+	}
+
+	// Rotating without a grace period revokes the previous token
+	previous := rotation.Token
+	path = fmt.Sprintf("/v1/app/%s/token/rotate?grace=0", app.ID)
+	if code := testRequest(t, e, http.MethodPost, path, previous, nil, &rotation); code != http.StatusOK {
+		t.Fatalf("Expected RotateToken to return 200, got %d", code)
+	}
+	for token, code := range map[string]int{
+		app.Token:      http.StatusUnauthorized,
+		previous:       http.StatusUnauthorized,
+		rotation.Token: http.StatusOK,
+	} {
+		if got := testRequest(t, e, http.MethodPost, createPath, token, nil, nil); got != code {
+			t.Errorf("Expected token %q to return %d, got %d", token, code, got)
+		}
+	}
+
+	// Other servers stop accepting a revoked token once their cached
+	// App expires, which is bounded however long the cache lasts
+	other, err := NewService(s.logger.Logger, "", s.store, 100, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create Service: %v", err)
+	}
+	if other.appExp != maxAppCacheExp {
+		t.Errorf("Expected Apps to be cached for %s, got %s", maxAppCacheExp, other.appExp)
+	}
+	other.appExp = 50 * time.Millisecond
+	otherRouter := other.Router()
+	if code := testRequest(t, otherRouter, http.MethodPost, createPath, rotation.Token,
+		nil, nil); code != http.StatusOK {
+		t.Fatalf("Expected the current token to be valid on another server, got %d", code)
+	}
+	revoked := rotation.Token
+	if code := testRequest(t, e, http.MethodPost, path, revoked, nil, &rotation); code != http.StatusOK {
+		t.Fatalf("Expected RotateToken to return 200, got %d", code)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if code := testRequest(t, otherRouter, http.MethodPost, createPath, revoked,
+		nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected the revoked token to be rejected by another server, got %d", code)
+	}
+}
+
+func TestKeyScopes(t *testing.T) {
+	_, e := newTestService(t)
+	app := createTestApp(t, e, "strict_auth=true")
+	other := createTestApp(t, e, "")
+
+	// Create a Key for every scope
+	keys := make(map[string]*models.Key)
+	for _, scope := range []string{models.ScopeIngest, models.ScopeRead, models.ScopeAdmin} {
+		var key models.Key
+		path := fmt.Sprintf("/v1/app/%s/keys/create/%s-key?scopes=%s", app.ID, scope, scope)
+		if code := testRequest(t, e, http.MethodPost, path, app.Token, nil, &key); code != http.StatusOK {
+			t.Fatalf("Expected CreateKey to return 200, got %d", code)
+		}
+		keys[scope] = &key
+	}
+	path := fmt.Sprintf("/v1/app/%s/keys/create/bad?scopes=everything", app.ID)
+	if code := testRequest(t, e, http.MethodPost, path, app.Token, nil, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown scope to return 400, got %d", code)
+	}
+
+	// Every Key may only be used for its own scope and App
+	createPath := fmt.Sprintf("/v1/app/%s/action/signup/create/1", app.ID)
+	countPath := fmt.Sprintf("/v1/app/%s/action/signup/count/1h", app.ID)
+	keysPath := fmt.Sprintf("/v1/app/%s/keys", app.ID)
+	for _, test := range []struct {
+		method, path, scope string
+		code                int
+	}{
+		{http.MethodPost, createPath, models.ScopeIngest, http.StatusOK},
+		{http.MethodGet, countPath, models.ScopeIngest, http.StatusForbidden},
+		{http.MethodGet, keysPath, models.ScopeIngest, http.StatusForbidden},
+		{http.MethodPost, createPath, models.ScopeRead, http.StatusForbidden},
+		{http.MethodGet, countPath, models.ScopeRead, http.StatusOK},
+		{http.MethodGet, keysPath, models.ScopeRead, http.StatusForbidden},
+		{http.MethodGet, keysPath, models.ScopeAdmin, http.StatusOK},
+		{http.MethodPost, fmt.Sprintf("/v1/app/%s/action/signup/create/1", other.ID),
+			models.ScopeIngest, http.StatusUnauthorized},
+	} {
+		if code := testRequest(t, e, test.method, test.path, keys[test.scope].Token,
+			nil, nil); code != test.code {
+			t.Errorf("Expected %s %s with an %s key to return %d, got %d",
+				test.method, test.path, test.scope, test.code, code)
+		}
+	}
+
+	// A Key with the wrong secret is rejected
+	forged := keys[models.ScopeIngest].ID + ".wrong"
+	if code := testRequest(t, e, http.MethodPost, createPath, forged, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected a Key with the wrong secret to return 401, got %d", code)
+	}
+
+	// Revoked Keys are rejected immediately by the revoking server
+	revokePath := fmt.Sprintf("/v1/app/%s/keys/%s", app.ID, keys[models.ScopeIngest].ID)
+	if code := testRequest(t, e, http.MethodDelete, revokePath, keys[models.ScopeAdmin].Token,
+		nil, nil); code != http.StatusOK {
+		t.Fatalf("Expected RevokeKey to return 200, got %d", code)
+	}
+	if code := testRequest(t, e, http.MethodPost, createPath, keys[models.ScopeIngest].Token,
+		nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected a revoked Key to return 401, got %d", code)
+	}
+}
+
+// countingStore counts the Apps and Keys retrieved from a Store
+type countingStore struct {
+	Store
+	gets int32
+}
+
+// GetApp counts and retrieves an App from the underlying Store
+func (s *countingStore) GetApp(appID string) (*App, error) {
+	atomic.AddInt32(&s.gets, 1)
+	return s.Store.GetApp(appID)
+}
+
+// GetKey counts and retrieves a Key from the underlying Store
+func (s *countingStore) GetKey(keyID string) (*Key, error) {
+	atomic.AddInt32(&s.gets, 1)
+	return s.Store.GetKey(keyID)
+}
+
+func TestInvalidTokenReloads(t *testing.T) {
+	s, e := newTestService(t)
+	store := &countingStore{Store: s.store}
+	s.store = store
+	app := createTestApp(t, e, "")
+
+	// Invalid App and Key tokens only reach the DB once per interval
+	createPath := fmt.Sprintf("/v1/app/%s/action/signup/create/1", app.ID)
+	for _, token := range []string{"invalid", "unknown.secret"} {
+		atomic.StoreInt32(&store.gets, 0)
+		for i := 0; i < 10; i++ {
+			if code := testRequest(t, e, http.MethodPost, createPath, token, nil, nil); code != http.StatusUnauthorized {
+				t.Fatalf("Expected token %q to return 401, got %d", token, code)
+			}
+		}
+		if gets := atomic.LoadInt32(&store.gets); gets > 1 {
+			t.Errorf("Expected token %q to be looked up at most once, got %d", token, gets)
+		}
+	}
+
+	// The valid token is accepted without reloading the App
+	if code := testRequest(t, e, http.MethodPost, createPath, app.Token, nil, nil); code != http.StatusOK {
+		t.Errorf("Expected the Apps token to return 200, got %d", code)
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+)
+
+// NewMySQLStore connects to the MySQL database at the passed URL,
+// migrates all tables and returns it as a Store
+func NewMySQLStore(mysqlURL string) (Store, error) {
+	// Always decode DATETIME columns into UTC time.Time values
+	cfg, err := mysql.ParseDSN(mysqlURL)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+
+	db, err := gorm.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate(db.Set("gorm:table_options", "CHARSET=utf8"),
+		`SELECT CHARACTER_MAXIMUM_LENGTH FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'actions' AND COLUMN_NAME = 'tags'`,
+		`ALTER TABLE actions MODIFY COLUMN tags varchar(329) NOT NULL DEFAULT ''`); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqlStore{
+		db:                 db,
+		incrementActionSQL: `INSERT INTO actions(id, app_id, action, tags, count, timestamp) VALUES(?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE count = count + VALUES(count)`,
+		purgeBucketsSQL:    `DELETE FROM %[1]s WHERE app_id = ? AND timestamp < ? LIMIT ?`,
+		lockRowsOption:     "FOR UPDATE",
+		isConflict:         isMySQLConflict,
+	}, nil
+}
+
+// isMySQLConflict reports whether err is a MySQL duplicate entry error
+func isMySQLConflict(err error) bool {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	return ok && mysqlErr.Number == 1062
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/lib/pq"
+)
+
+// NewPostgresStore connects to the PostgreSQL database at the passed
+// URL, migrates all tables and returns it as a Store
+func NewPostgresStore(postgresURL string) (Store, error) {
+	db, err := gorm.Open("postgres", postgresURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate(db,
+		`SELECT character_maximum_length FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'actions' AND column_name = 'tags'`,
+		`ALTER TABLE actions ALTER COLUMN tags TYPE varchar(329)`); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqlStore{
+		db:                 db,
+		incrementActionSQL: `INSERT INTO actions(id, app_id, action, tags, count, timestamp) VALUES(?, ?, ?, ?, ?, ?) ON CONFLICT (id) DO UPDATE SET count = actions.count + EXCLUDED.count`,
+		purgeBucketsSQL:    `DELETE FROM %[1]s WHERE id IN (SELECT id FROM %[1]s WHERE app_id = ? AND timestamp < ? LIMIT ?)`,
+		lockRowsOption:     "FOR UPDATE",
+		isConflict:         isPostgresConflict,
+	}, nil
+}
+
+// isPostgresConflict reports whether err is a PostgreSQL unique
+// violation error
+func isPostgresConflict(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/sdwolfe32/tinystat/client"
+	"github.com/sdwolfe32/tinystat/models"
+	"golang.org/x/sync/errgroup"
+)
+
+// maxQueryActions is the maximum number of actions a single query may
+// count
+const maxQueryActions = 10
+
+// ErrInvalidQueryActions is thrown when the actions of a query can't be parsed
+var ErrInvalidQueryActions = echo.NewHTTPError(http.StatusBadRequest,
+	"Actions must be a comma separated list of 1 to 10 distinct action names, or 2 to 10 for a funnel")
+
+// QueryActions retrieves the count of several actions for an app in
+// the passed duration along with the share of the total and the ratio
+// to the first action of each. Duration should match the same
+// formatting as https://golang.org/pkg/time/#ParseDuration
+// If funnel=true is passed the actions are treated as ordered steps
+// and the conversion from every step to the next is included. Only
+// actions with all the passed tags are counted
+// Endpoint: /app/:app_id/query/:duration?actions=:actions&funnel=:funnel&tags=:tags
+func (s *Service) QueryActions(c echo.Context) error {
+	l := s.logger.WithField("method", "query_actions")
+	l.Debug("Received new QueryActions request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	duration := c.Param("duration")
+	funnel, _ := strconv.ParseBool(c.QueryParam("funnel"))
+	tags, err := models.ParseTags(c.QueryParam("tags"))
+	if err != nil {
+		l.WithError(err).Error("Failed to parse requested tags")
+		return ErrInvalidTags
+	}
+	l = l.WithFields(map[string]interface{}{"app_id": appID, "duration": duration,
+		"funnel": funnel, "tags": tags.String()})
+
+	// Parse the requested actions
+	actions, err := parseQueryActions(c.QueryParam("actions"), funnel)
+	if err != nil {
+		l.WithError(err).Error("Failed to parse requested actions")
+		return err
+	}
+	l = l.WithField("actions", actions)
+
+	// Parse the duration passed
+	l.Debug("Parsing the requested duration")
+	dur, err := time.ParseDuration(duration)
+	if err != nil {
+		l.WithError(err).Error("Failed to parse duration")
+		return ErrParseDurationFailure
+	}
+
+	// Retrieve the App to determine its bucket resolution
+	app, err := s.requestApp(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return ErrAppRetrievalFailure
+	}
+
+	// Retrieve the count of every action from the DB and return
+	l.Debug("Retrieve the counts of Actions from the DB")
+	query, err := s.actionQuery(ActionFilter{AppID: appID, Tags: tags,
+		Start: s.bucketStart(app, time.Now().Add(-1*dur))}, actions, funnel)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve Action sums")
+		return ErrCountSumFailure
+	}
+
+	// Report the successful query-actions to ourselves
+	go client.CreateAction("query-actions")
+
+	// Return an Status OK
+	l.Debug("Returning successful QueryActions response")
+	return c.JSON(http.StatusOK, query)
+}
+
+// QueryActionsRange retrieves the count of several actions for an app
+// between two absolute times. Times behave the same as in
+// ActionRangeCount and everything else the same as in QueryActions
+// Endpoint: /app/:app_id/query?from=:from&to=:to&actions=:actions&funnel=:funnel&tags=:tags
+func (s *Service) QueryActionsRange(c echo.Context) error {
+	l := s.logger.WithField("method", "query_actions_range")
+	l.Debug("Received new QueryActionsRange request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	funnel, _ := strconv.ParseBool(c.QueryParam("funnel"))
+	tags, err := models.ParseTags(c.QueryParam("tags"))
+	if err != nil {
+		l.WithError(err).Error("Failed to parse requested tags")
+		return ErrInvalidTags
+	}
+	l = l.WithFields(map[string]interface{}{"app_id": appID,
+		"funnel": funnel, "tags": tags.String()})
+
+	// Parse the requested actions
+	actions, err := parseQueryActions(c.QueryParam("actions"), funnel)
+	if err != nil {
+		l.WithError(err).Error("Failed to parse requested actions")
+		return err
+	}
+	l = l.WithField("actions", actions)
+
+	// Parse the requested time range
+	l.Debug("Parsing the requested time range")
+	from, to, err := parseTimeRange(c, nil)
+	if err != nil {
+		l.WithError(err).Error("Failed to parse time range")
+		return err
+	}
+	l = l.WithFields(map[string]interface{}{"from": from, "to": to})
+
+	// Retrieve the App to determine its bucket resolution
+	app, err := s.requestApp(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return ErrAppRetrievalFailure
+	}
+
+	// Retrieve the count of every action from the DB and return
+	l.Debug("Retrieve the counts of Actions from the DB")
+	query, err := s.actionQuery(ActionFilter{AppID: appID, Tags: tags,
+		Start: s.bucketStart(app, from), End: to}, actions, funnel)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve Action sums")
+		return ErrCountSumFailure
+	}
+
+	// Report the successful query-actions-range to ourselves
+	go client.CreateAction("query-actions-range")
+
+	// Return an Status OK
+	l.Debug("Returning successful QueryActionsRange response")
+	return c.JSON(http.StatusOK, query)
+}
+
+// parseQueryActions parses a comma separated list of distinct action
+// names. Funnels require at least two steps
+func parseQueryActions(value string, funnel bool) ([]string, error) {
+	actions := strings.Split(value, ",")
+	if len(actions) > maxQueryActions || (funnel && len(actions) < 2) {
+		return nil, ErrInvalidQueryActions
+	}
+	seen := make(map[string]bool, len(actions))
+	for _, action := range actions {
+		if action == "" || len(action) > maxActionLength || seen[action] {
+			return nil, ErrInvalidQueryActions
+		}
+		seen[action] = true
+	}
+	return actions, nil
+}
+
+// actionQuery concurrently retrieves the count of every passed action
+// matching the filter and derives an ActionQuery from them
+func (s *Service) actionQuery(filter ActionFilter, actions []string, funnel bool) (*models.ActionQuery, error) {
+	var g errgroup.Group
+	counts := make([]int64, len(actions))
+	for i, action := range actions {
+		i, filter := i, filter
+		filter.Action = action
+		g.Go(func() error { return s.actionSum(&counts[i], filter) })
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return models.NewActionQuery(actions, counts, funnel), nil
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+func TestQueryActions(t *testing.T) {
+	s, e := newTestService(t)
+	app := createTestApp(t, e, "")
+
+	// Seed recent actions and actions of a day long ago
+	now := app.bucket(time.Now())
+	day := time.Date(2018, time.January, 2, 0, 0, 0, 0, time.UTC)
+	for _, seed := range []struct {
+		action, tags string
+		timestamp    time.Time
+		count        int
+	}{
+		{"visit", "", now, 8},
+		{"signup", "", now, 2},
+		{"signup", "platform:ios", now, 2},
+		{"purchase", "", now, 1},
+		{"visit", "", day, 10},
+	} {
+		tags, _ := models.ParseTags(seed.tags)
+		if err := s.store.IncrementAction(app.ID, seed.action, tags, seed.count, seed.timestamp); err != nil {
+			t.Fatalf("Failed to seed Actions: %v", err)
+		}
+	}
+	path := fmt.Sprintf("/v1/app/%s/query", app.ID)
+
+	// Every action is counted along with its share and ratio
+	var query models.ActionQuery
+	if code := testRequest(t, e, http.MethodGet, path+"/1h?actions=visit,signup,purchase&funnel=true",
+		"", nil, &query); code != http.StatusOK {
+		t.Fatalf("Expected QueryActions to return 200, got %d", code)
+	}
+	if query.Total != 13 || len(query.Actions) != 3 || len(query.Funnel) != 2 {
+		t.Fatalf("Expected 3 actions and 2 funnel steps totalling 13, got %+v", query)
+	}
+	signup := query.Actions[1]
+	if signup.Action != "signup" || signup.Count != 4 || signup.Ratio == nil || *signup.Ratio != 0.5 {
+		t.Errorf("Expected signup to be half of visit, got %+v", signup)
+	}
+	for i, expected := range []models.FunnelStep{
+		{From: "visit", To: "signup", DropOff: 4},
+		{From: "signup", To: "purchase", DropOff: 3},
+	} {
+		step := query.Funnel[i]
+		if step.From != expected.From || step.To != expected.To || step.DropOff != expected.DropOff {
+			t.Errorf("Expected funnel step %d to be %+v, got %+v", i, expected, step)
+		}
+	}
+
+	// Only actions with the passed tags are counted
+	query = models.ActionQuery{}
+	if code := testRequest(t, e, http.MethodGet, path+"/1h?actions=visit,signup&tags=platform:ios",
+		"", nil, &query); code != http.StatusOK {
+		t.Fatalf("Expected a tagged QueryActions to return 200, got %d", code)
+	}
+	if query.Total != 2 || query.Actions[1].Count != 2 || query.Actions[1].Ratio != nil {
+		t.Errorf("Expected only the tagged signups to be counted, got %+v", query)
+	}
+
+	// Ranges only count actions between from and to
+	query = models.ActionQuery{}
+	rangePath := fmt.Sprintf("%s?from=%d&to=%d&actions=visit,signup&funnel=true",
+		path, day.Unix(), day.Add(24*time.Hour).Unix())
+	if code := testRequest(t, e, http.MethodGet, rangePath, "", nil, &query); code != http.StatusOK {
+		t.Fatalf("Expected QueryActionsRange to return 200, got %d", code)
+	}
+	if query.Total != 10 || query.Funnel[0].Conversion == nil || *query.Funnel[0].Conversion != 0 ||
+		query.Funnel[0].DropOff != 10 {
+		t.Errorf("Expected every visit of the day to drop off, got %+v", query)
+	}
+
+	// Invalid actions, durations and tags are rejected
+	var tooMany []string
+	for i := 0; i <= maxQueryActions; i++ {
+		tooMany = append(tooMany, fmt.Sprintf("step%d", i))
+	}
+	for _, query := range []string{
+		"/1h",
+		"/1h?actions=visit,,signup",
+		"/1h?actions=visit,visit",
+		"/1h?actions=visit&funnel=true",
+		"/1h?actions=" + strings.Join(tooMany, ","),
+		"/forever?actions=visit",
+		"/1h?actions=visit&tags=platform",
+		"?from=soon&actions=visit",
+	} {
+		if code := testRequest(t, e, http.MethodGet, path+query, "", nil, nil); code != http.StatusBadRequest {
+			t.Errorf("Expected GET %s to return 400, got %d", path+query, code)
+		}
+	}
+}
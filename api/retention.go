@@ -0,0 +1,71 @@
+package api
+
+import "time"
+
+// StartPurge begins a background worker that every freq deletes the
+// buckets of every metric type older than each Apps retention period.
+// Apps without a retention period of their own use defaultDays, and a
+// retention period of 0 or less keeps buckets forever. Buckets are
+// deleted in batches of at most batchSize
+func (s *Service) StartPurge(defaultDays, batchSize int, freq time.Duration) {
+	if batchSize <= 0 || freq <= 0 {
+		return
+	}
+	go s.purgeWorker(defaultDays, batchSize, freq)
+}
+
+// purgeWorker periodically purges expired Action buckets until the
+// Service is closed
+func (s *Service) purgeWorker(defaultDays, batchSize int, freq time.Duration) {
+	ticker := time.NewTicker(freq)
+	defer ticker.Stop()
+	for {
+		s.purgeActions(defaultDays, batchSize, time.Now())
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeActions deletes the expired Action buckets of every App
+func (s *Service) purgeActions(defaultDays, batchSize int, now time.Time) {
+	l := s.logger.WithField("method", "purge_actions")
+
+	// Retrieve every App to determine its retention period
+	apps, err := s.store.ListApps()
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve Apps")
+		return
+	}
+
+	for _, app := range apps {
+		days := app.retentionDays(defaultDays)
+		if days <= 0 {
+			continue
+		}
+		// Buckets rolled up into days or months are only deleted once
+		// the whole interval they cover has expired
+		before := s.bucketStart(app, now.AddDate(0, 0, -1*days))
+		al := l.WithFields(map[string]interface{}{
+			"app_id": app.ID, "retention_days": days})
+
+		// Delete batches until one comes back less than full
+		var removed int64
+		for {
+			n, err := s.store.PurgeActions(app.ID, before, batchSize)
+			if err != nil {
+				al.WithError(err).Error("Failed to purge buckets")
+				break
+			}
+			removed += n
+			if n < int64(batchSize) {
+				break
+			}
+		}
+		if removed > 0 {
+			al.WithField("removed", removed).Info("Purged expired buckets")
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPurgeActions(t *testing.T) {
+	s, e := newTestService(t)
+	app := createTestApp(t, e, "retention_days=30")
+	keep := createTestApp(t, e, "retention_days=-1")
+	s.rollups = []*rollupLevel{{interval: "month", age: 24 * time.Hour}}
+
+	// January and February have been rolled up into single buckets
+	// and the retention period ends partway through February
+	now := time.Date(2018, time.March, 20, 12, 0, 0, 0, time.UTC)
+	january := time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)
+	february := time.Date(2018, time.February, 1, 0, 0, 0, 0, time.UTC)
+	march := time.Date(2018, time.March, 1, 0, 0, 0, 0, time.UTC)
+	if err := s.store.SetRollupRolled("month", march); err != nil {
+		t.Fatalf("Failed to store rollup state: %v", err)
+	}
+	for _, appID := range []string{app.ID, keep.ID} {
+		for _, timestamp := range []time.Time{january, february, march.Add(10 * 24 * time.Hour)} {
+			if err := s.store.IncrementAction(appID, "signup", nil, 1, timestamp); err != nil {
+				t.Fatalf("Failed to seed Actions: %v", err)
+			}
+		}
+	}
+	s.purgeActions(0, 1, now)
+
+	// Only the month that expired entirely is purged, and only from
+	// the App with a retention period
+	for _, test := range []struct {
+		appID string
+		start time.Time
+		count int64
+	}{
+		{app.ID, january, 0},
+		{app.ID, february, 1},
+		{app.ID, march, 1},
+		{keep.ID, january, 1},
+	} {
+		count, err := s.store.SumActions(ActionFilter{AppID: test.appID,
+			Start: test.start, End: addIntervals(test.start, "month", 1)})
+		if err != nil {
+			t.Fatalf("Failed to sum Actions: %v", err)
+		}
+		if count != test.count {
+			t.Errorf("Expected a count of %d from %s, got %d", test.count, test.start, count)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package api
+
+import "time"
+
+// rollupMarkCacheExp is how long the progress of a rollup level is
+// cached for reads before being reloaded from the Store
+const rollupMarkCacheExp = time.Minute
+
+// rollupLevel describes a single level of Action compaction, rolling
+// all buckets older than age into one bucket per interval
+type rollupLevel struct {
+	interval string        // series interval buckets are rolled into
+	age      time.Duration // age after which buckets are rolled up
+}
+
+// RollupState is the persisted progress of a single rollup level,
+// shared by every Service using the same Store
+type RollupState struct {
+	Name    string     `gorm:"type:varchar(10);primary_key"` // interval of the level
+	Rolled  *time.Time // start of the first interval not yet rolled up
+	Pending *time.Time // start of the oldest rolled up interval written to since
+}
+
+// StartRollup begins a background worker that every freq rolls all
+// Action buckets older than dailyAge into daily buckets and all
+// buckets older than monthlyAge into monthly buckets. A zero age
+// disables that level of compaction. Counts remain exact for any
+// range aligned to the resolution retained for its start
+func (s *Service) StartRollup(dailyAge, monthlyAge, freq time.Duration) {
+	if dailyAge > 0 {
+		s.rollups = append(s.rollups, &rollupLevel{interval: "day", age: dailyAge})
+	}
+	if monthlyAge > 0 {
+		s.rollups = append(s.rollups, &rollupLevel{interval: "month", age: monthlyAge})
+	}
+	if len(s.rollups) == 0 || freq <= 0 {
+		return
+	}
+	go s.rollupWorker(freq)
+}
+
+// rollupWorker periodically rolls up old Action buckets until the
+// Service is closed
+func (s *Service) rollupWorker(freq time.Duration) {
+	ticker := time.NewTicker(freq)
+	defer ticker.Stop()
+	for {
+		for _, level := range s.rollups {
+			s.rollupActions(level, time.Now())
+		}
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// rollupActions rolls up every interval of the passed level that has
+// completely aged out since the last run, along with any rolled up
+// interval that has been backfilled since, one interval at a time
+func (s *Service) rollupActions(level *rollupLevel, now time.Time) {
+	l := s.logger.WithFields(map[string]interface{}{
+		"method": "rollup_actions", "interval": level.interval})
+
+	// Find the first interval to roll up, beginning at the oldest
+	// bucket if this level has never run
+	state, err := s.store.GetRollupState(level.interval)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve rollup state")
+		return
+	}
+	var start, rolled time.Time
+	if state.Rolled != nil {
+		start, rolled = *state.Rolled, *state.Rolled
+	} else {
+		oldest, err := s.store.OldestBucket()
+		if err != nil {
+			l.WithError(err).Error("Failed to retrieve oldest bucket")
+			return
+		}
+		if oldest.IsZero() {
+			return
+		}
+		start = truncateInterval(oldest, level.interval)
+	}
+
+	// Begin again at any interval backfilled after being rolled up,
+	// clearing it first so backfills made during this run are kept
+	if state.Pending != nil {
+		if state.Pending.Before(start) {
+			start = *state.Pending
+		}
+		if err := s.store.ClearRollupPending(level.interval, *state.Pending); err != nil {
+			l.WithError(err).Error("Failed to clear pending rollup")
+			return
+		}
+	}
+
+	// Roll up every interval before the cutoff
+	cutoff := truncateInterval(now.Add(-1*level.age), level.interval)
+	var removed int64
+	for ; start.Before(cutoff); start = addIntervals(start, level.interval, 1) {
+		end := addIntervals(start, level.interval, 1)
+		n, err := s.store.RollupActions(start, end)
+		if err != nil {
+			l.WithError(err).WithField("start", start).Error("Failed to roll up Actions")
+			if start.Before(rolled) {
+				s.markRollupPending(level, start)
+			}
+			return
+		}
+		removed += n
+		if end.After(rolled) {
+			if err := s.store.SetRollupRolled(level.interval, end); err != nil {
+				l.WithError(err).WithField("start", start).Error("Failed to store rollup state")
+				return
+			}
+			rolled = end
+			s.cache.Set(rollupCacheKey(level.interval), rolled, rollupMarkCacheExp)
+		}
+	}
+	if removed > 0 {
+		l.WithField("removed", removed).Info("Rolled up Action buckets")
+	}
+}
+
+// rolledMark returns the start of the first interval of the passed
+// level not yet rolled up, or the zero time if none have been
+func (s *Service) rolledMark(level *rollupLevel) time.Time {
+	if markIface, ok := s.cache.Get(rollupCacheKey(level.interval)); ok {
+		return markIface.(time.Time)
+	}
+	state, err := s.store.GetRollupState(level.interval)
+	if err != nil {
+		s.logger.WithError(err).WithField("interval", level.interval).
+			Error("Failed to retrieve rollup state")
+		return time.Time{}
+	}
+	var mark time.Time
+	if state.Rolled != nil {
+		mark = *state.Rolled
+	}
+	s.cache.Set(rollupCacheKey(level.interval), mark, rollupMarkCacheExp)
+	return mark
+}
+
+// rollupCacheKey is the cache key of the rolled mark of a level
+func rollupCacheKey(interval string) string { return "rollup_" + interval }
+
+// backfillRollups flags the oldest already rolled up interval of every
+// level that any of the passed bucket timestamps fall in so that the
+// rollup worker rolls it up again
+func (s *Service) backfillRollups(timestamps ...time.Time) {
+	for _, level := range s.rollups {
+		mark := s.rolledMark(level)
+		var oldest time.Time
+		for _, t := range timestamps {
+			if start := truncateInterval(t, level.interval); start.Before(mark) &&
+				(oldest.IsZero() || start.Before(oldest)) {
+				oldest = start
+			}
+		}
+		if !oldest.IsZero() {
+			s.markRollupPending(level, oldest)
+		}
+	}
+}
+
+// markRollupPending flags the passed interval of a level to be rolled
+// up again, logging any failure
+func (s *Service) markRollupPending(level *rollupLevel, start time.Time) {
+	if err := s.store.MarkRollupPending(level.interval, start); err != nil {
+		s.logger.WithError(err).WithFields(map[string]interface{}{
+			"interval": level.interval, "start": start}).Error("Failed to mark pending rollup")
+	}
+}
+
+// bucketStart returns the start of the bucket the passed time occurs
+// in, taking into account both the Apps resolution and any rollup
+// that has been applied to buckets of that age
+func (s *Service) bucketStart(app *App, t time.Time) time.Time {
+	start := app.bucket(t)
+	for _, level := range s.rollups {
+		rolled := truncateInterval(t, level.interval)
+		if rolled.Before(start) && rolled.Before(s.rolledMark(level)) {
+			start = rolled
+		}
+	}
+	return start
+}
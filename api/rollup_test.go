@@ -0,0 +1,156 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+func TestRollupActions(t *testing.T) {
+	s, e := newTestService(t)
+	app := createTestApp(t, e, "max_backfill=2400h")
+	level := &rollupLevel{interval: "day", age: 30 * 24 * time.Hour}
+	s.rollups = []*rollupLevel{level}
+
+	// Seed every hour of a day long since aged out and of the day the
+	// cutoff falls in
+	now := time.Now()
+	old := truncateInterval(now.Add(-40*24*time.Hour), "day")
+	cutoff := truncateInterval(now.Add(-1*level.age), "day")
+	for _, day := range []time.Time{old, cutoff} {
+		for hour := 0; hour < 24; hour++ {
+			if err := s.store.IncrementAction(app.ID, "signup", nil, 1,
+				day.Add(time.Duration(hour)*time.Hour)); err != nil {
+				t.Fatalf("Failed to seed Actions: %v", err)
+			}
+		}
+	}
+	rangeCount := func(from, to time.Time) int64 {
+		return testCount(t, e, fmt.Sprintf("/v1/app/%s/action/signup/range?from=%d&to=%d",
+			app.ID, from.Unix(), to.Unix()), "")
+	}
+	bucketCount := func(day time.Time) int {
+		buckets, err := s.store.SumActionBuckets(ActionFilter{AppID: app.ID,
+			Start: day, End: day.Add(24 * time.Hour)})
+		if err != nil {
+			t.Fatalf("Failed to retrieve buckets: %v", err)
+		}
+		return len(buckets)
+	}
+
+	// Ranges within a day are exact until the day is rolled up
+	if count := rangeCount(old.Add(6*time.Hour), old.Add(24*time.Hour)); count != 18 {
+		t.Errorf("Expected a count of 18 before rolling up, got %d", count)
+	}
+
+	// Only days before the cutoff are rolled up and stay exact
+	s.rollupActions(level, now)
+	if buckets := bucketCount(old); buckets != 1 {
+		t.Errorf("Expected the old day to be rolled into 1 bucket, got %d", buckets)
+	}
+	if buckets := bucketCount(cutoff); buckets != 24 {
+		t.Errorf("Expected the cutoff day to keep 24 buckets, got %d", buckets)
+	}
+	if count := rangeCount(old, old.Add(24*time.Hour)); count != 24 {
+		t.Errorf("Expected a count of 24 for the rolled up day, got %d", count)
+	}
+	if count := rangeCount(cutoff.Add(12*time.Hour), cutoff.Add(24*time.Hour)); count != 12 {
+		t.Errorf("Expected a count of 12 within the cutoff day, got %d", count)
+	}
+
+	// The rollup progress is shared by every Service using the Store
+	other, err := NewService(s.logger.Logger, "", s.store, 100, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create Service: %v", err)
+	}
+	if mark := other.rolledMark(level); !mark.Equal(cutoff) {
+		t.Errorf("Expected a rolled mark of %s, got %s", cutoff, mark)
+	}
+
+	// Backfilling a rolled up day rolls it up again on the next run
+	entries := []models.ActionEntry{{Action: "signup", Count: 2, Timestamp: old.Add(5 * time.Hour)}}
+	if code := testRequest(t, e, http.MethodPost, fmt.Sprintf("/v1/app/%s/actions", app.ID),
+		app.Token, entries, nil); code != http.StatusOK {
+		t.Fatalf("Expected CreateActions to return 200, got %d", code)
+	}
+	state, err := s.store.GetRollupState(level.interval)
+	if err != nil || state.Pending == nil || !state.Pending.Equal(old) {
+		t.Fatalf("Expected the old day to be pending, got %+v (%v)", state, err)
+	}
+	s.rollupActions(level, now)
+	if buckets := bucketCount(old); buckets != 1 {
+		t.Errorf("Expected the backfilled day to be rolled into 1 bucket, got %d", buckets)
+	}
+	if count := rangeCount(old, old.Add(24*time.Hour)); count != 26 {
+		t.Errorf("Expected a count of 26 for the backfilled day, got %d", count)
+	}
+	if state, err = s.store.GetRollupState(level.interval); err != nil || state.Pending != nil {
+		t.Errorf("Expected no pending day after rolling up, got %+v (%v)", state, err)
+	}
+}
+
+func TestRollupSketches(t *testing.T) {
+	s, e := newTestService(t)
+	app := createTestApp(t, e, "")
+	level := &rollupLevel{interval: "day", age: 30 * 24 * time.Hour}
+
+	// Only Gauges exist so the oldest bucket must come from them
+	old := truncateInterval(time.Now().Add(-40*24*time.Hour), "day")
+	for hour := 0; hour < 24; hour++ {
+		timestamp := old.Add(time.Duration(hour) * time.Hour)
+		if err := s.store.RecordGauge(app.ID, "queue", models.Gauge{Last: float64(hour),
+			Min: float64(hour), Max: float64(hour), Sum: float64(hour), Samples: 1,
+			LastAt: timestamp}, timestamp); err != nil {
+			t.Fatalf("Failed to seed Gauges: %v", err)
+		}
+	}
+	s.rollupActions(level, time.Now())
+
+	gauge, err := s.store.AggregateGauge(ActionFilter{AppID: app.ID, Action: "queue",
+		Start: old, End: old.Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("Failed to aggregate Gauge: %v", err)
+	}
+	if gauge.Samples != 24 || gauge.Min != 0 || gauge.Max != 23 || gauge.Last != 23 {
+		t.Errorf("Expected the rolled up Gauge to keep every sample, got %+v", gauge)
+	}
+	if mark := s.rolledMark(level); mark.IsZero() {
+		t.Error("Expected Gauge buckets to be rolled up")
+	}
+}
+
+func TestActionSeriesRollup(t *testing.T) {
+	s, e := newTestService(t)
+	app := createTestApp(t, e, "")
+	s.rollups = []*rollupLevel{{interval: "day", age: 24 * time.Hour}}
+
+	// Roll every hour of a day up into a single bucket
+	day := time.Date(2018, time.January, 2, 0, 0, 0, 0, time.UTC)
+	for hour := 0; hour < 24; hour++ {
+		if err := s.store.IncrementAction(app.ID, "signup", nil, 1,
+			day.Add(time.Duration(hour)*time.Hour)); err != nil {
+			t.Fatalf("Failed to seed Actions: %v", err)
+		}
+	}
+	if _, err := s.store.RollupActions(day, day.Add(24*time.Hour)); err != nil {
+		t.Fatalf("Failed to roll up Actions: %v", err)
+	}
+	if err := s.store.SetRollupRolled("day", day.Add(24*time.Hour)); err != nil {
+		t.Fatalf("Failed to store rollup state: %v", err)
+	}
+
+	// A series starting partway through the day counts all of it in
+	// its first point
+	var series []models.SeriesPoint
+	path := fmt.Sprintf("/v1/app/%s/action/signup/series?interval=hour&from=%d&to=%d",
+		app.ID, day.Add(12*time.Hour).Unix(), day.Add(15*time.Hour).Unix())
+	if code := testRequest(t, e, http.MethodGet, path, "", nil, &series); code != http.StatusOK {
+		t.Fatalf("Expected ActionSeries to return 200, got %d", code)
+	}
+	if len(series) != 3 || series[0].Count != 24 || series[1].Count != 0 || series[2].Count != 0 {
+		t.Errorf("Expected the rolled up day in the first point, got %+v", series)
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+)
+
+// Router generates a new echo router with all Tinystat API
+// endpoints and middleware bound to the Service
+func (s *Service) Router() *echo.Echo {
+	e := echo.New()
+	e.Use(middleware.Recover())
+
+	e.POST("/v1/app/create/:name", s.CreateApp, s.RateLimit, s.AdminAuth)
+	e.GET("/v1/app/:app_id", s.GetApp, s.AdminAuth)
+	e.DELETE("/v1/app/:app_id", s.DeleteApp, s.AdminAuth)
+	e.POST("/v1/app/:app_id/rename/:name", s.RenameApp, s.AdminAuth)
+	e.POST("/v1/app/:app_id/strict_auth/:strict_auth", s.SetStrictAuth, s.AdminAuth)
+	e.POST("/v1/app/:app_id/token/rotate", s.RotateToken, s.RateLimit, s.AppAdminAuth)
+	e.POST("/v1/app/:app_id/keys/create/:name", s.CreateKey, s.RateLimit, s.AppAdminAuth)
+	e.GET("/v1/app/:app_id/keys", s.ListKeys, s.AppAdminAuth)
+	e.DELETE("/v1/app/:app_id/keys/:key_id", s.RevokeKey, s.AppAdminAuth)
+	e.POST("/v1/app/:app_id/actions", s.CreateActions, s.RateLimit, s.TokenAuth)
+	e.GET("/v1/app/:app_id/actions", s.ListActions, s.TokenAuth)
+	e.GET("/v1/app/:app_id/actions/top", s.TopActionsRange, s.TokenAuth)
+	e.GET("/v1/app/:app_id/actions/top/:duration", s.TopActions, s.TokenAuth)
+	e.POST("/v1/app/:app_id/action/:action/create/:count", s.CreateAction, s.RateLimit, s.TokenAuth)
+	e.GET("/v1/app/:app_id/action/:action/count", s.ActionSummary, s.TokenAuth)
+	e.GET("/v1/app/:app_id/action/:action/count/:duration", s.ActionCount, s.TokenAuth)
+	e.GET("/v1/app/:app_id/action/:action/range", s.ActionRangeCount, s.TokenAuth)
+	e.GET("/v1/app/:app_id/action/:action/series", s.ActionSeries, s.TokenAuth)
+	e.POST("/v1/app/:app_id/action/:action/unique", s.CreateUnique, s.RateLimit, s.TokenAuth)
+	e.GET("/v1/app/:app_id/action/:action/unique", s.UniqueRangeCount, s.TokenAuth)
+	e.GET("/v1/app/:app_id/action/:action/unique/:duration", s.UniqueCount, s.TokenAuth)
+	e.POST("/v1/app/:app_id/action/:action/distribution", s.CreateDistribution, s.RateLimit, s.TokenAuth)
+	e.GET("/v1/app/:app_id/action/:action/percentiles", s.ActionRangePercentiles, s.TokenAuth)
+	e.GET("/v1/app/:app_id/action/:action/percentiles/:duration", s.ActionPercentiles, s.TokenAuth)
+	e.GET("/v1/app/:app_id/query", s.QueryActionsRange, s.TokenAuth)
+	e.GET("/v1/app/:app_id/query/:duration", s.QueryActions, s.TokenAuth)
+	e.POST("/v1/app/:app_id/gauge/:gauge", s.MergeGauge, s.RateLimit, s.TokenAuth)
+	e.POST("/v1/app/:app_id/gauge/:gauge/set/:value", s.SetGauge, s.RateLimit, s.TokenAuth)
+	e.GET("/v1/app/:app_id/gauge/:gauge/stats/:duration", s.GaugeStats, s.TokenAuth)
+	e.GET("/v1/app/:app_id/gauge/:gauge/range", s.GaugeRangeStats, s.TokenAuth)
+	e.GET("/v1/stats", s.Stats)
+	return e
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/sdwolfe32/tinystat/client"
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+// maxSeriesPoints is the maximum number of points a single
+// series request may return
+const maxSeriesPoints = 1000
+
+var (
+	// ErrInvalidInterval is thrown when an unknown series interval is requested
+	ErrInvalidInterval = echo.NewHTTPError(http.StatusBadRequest, "Interval must be one of minute, hour, day, week or month")
+	// ErrIntervalTooFine is thrown when a series interval is smaller than the Apps resolution
+	ErrIntervalTooFine = echo.NewHTTPError(http.StatusBadRequest, "Interval must not be smaller than the Apps resolution")
+	// ErrTooManyPoints is thrown when a series would contain too many points
+	ErrTooManyPoints = echo.NewHTTPError(http.StatusBadRequest, "Requested series contains too many points")
+)
+
+// ActionSeries retrieves the count of actions for an app in every
+// interval between two times, including intervals without actions.
+// Times should be formatted as RFC3339 or unix seconds and interval
+// must be one of minute, hour, day, week or month and may not be
+// smaller than the Apps resolution. Buckets rolled up into days or
+// months are counted in full in the point their day or month begins
+// in, or the first point if it begins before the series. Tags and
+// group_by behave the same as in ActionCount, returning a series for
+// every value of the tag
+// Endpoint: /app/:app_id/action/:action/series?from=:from&to=:to&interval=:interval&tags=:tags&group_by=:group_by
+func (s *Service) ActionSeries(c echo.Context) error {
+	l := s.logger.WithField("method", "action_series")
+	l.Debug("Received new ActionSeries request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	action := c.Param("action")
+	interval := c.QueryParam("interval")
+	if interval == "" {
+		interval = "hour"
+	}
+	tags, groupBy, err := parseTagQuery(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to parse requested tags")
+		return err
+	}
+	l = l.WithFields(map[string]interface{}{"app_id": appID, "action": action,
+		"interval": interval, "tags": tags.String(), "group_by": groupBy})
+
+	// Verify the interval is one we know how to truncate to
+	if _, ok := intervalSteps[interval]; !ok {
+		l.Error("Invalid series interval requested")
+		return ErrInvalidInterval
+	}
+
+	// Verify the interval isn't smaller than the Apps buckets
+	app, err := s.requestApp(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return ErrAppRetrievalFailure
+	}
+	if now := time.Now(); addIntervals(now, interval, 1).Sub(now) < app.resolution() {
+		l.Error("Series interval smaller than App resolution requested")
+		return ErrIntervalTooFine
+	}
+
+	// Parse the range, defaulting to the last 24 intervals
+	l.Debug("Parsing the requested time range")
+	from, to, err := parseTimeRange(c, func(to time.Time) time.Time {
+		return addIntervals(to, interval, -24)
+	})
+	if err != nil {
+		l.WithError(err).Error("Failed to parse time range")
+		return err
+	}
+	start := truncateInterval(from, interval)
+	if addIntervals(start, interval, maxSeriesPoints).Before(to) {
+		l.Error("Requested series contains too many points")
+		return ErrTooManyPoints
+	}
+
+	// Retrieve the bucket totals from the DB, including any rolled up
+	// bucket the series begins in
+	l.Debug("Retrieving Action buckets from the DB")
+	buckets, err := s.store.SumActionBuckets(ActionFilter{
+		AppID: appID, Action: action, Start: s.bucketStart(app, start), End: to, Tags: tags})
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve Action buckets")
+		return ErrCountSumFailure
+	}
+
+	// Report the successful action-series to ourselves
+	go client.CreateAction("action-series")
+
+	// Return an Status OK
+	l.Debug("Returning successful ActionSeries response")
+	if groupBy != "" {
+		return c.JSON(http.StatusOK, groupedSeries(buckets, start, to, interval, groupBy))
+	}
+	return c.JSON(http.StatusOK, buildSeries(buckets, start, to, interval))
+}
+
+// buildSeries places all buckets into the interval they occured in,
+// generating a point for every interval between start and end.
+// Buckets beginning before start, such as the month start was rolled
+// up into, are placed into the first interval
+func buildSeries(buckets []BucketResult, start, end time.Time, interval string) []models.SeriesPoint {
+	series := []models.SeriesPoint{}
+	index := make(map[time.Time]int)
+	for t := start; t.Before(end); t = addIntervals(t, interval, 1) {
+		index[t] = len(series)
+		series = append(series, models.SeriesPoint{Timestamp: t})
+	}
+	for _, b := range buckets {
+		if b.Timestamp.Before(start) && len(series) > 0 {
+			series[0].Count += b.Total
+			continue
+		}
+		if i, ok := index[truncateInterval(b.Timestamp, interval)]; ok {
+			series[i].Count += b.Total
+		}
+	}
+	return series
+}
+
+// intervalSteps maps every series interval to the years, months
+// and days it spans. Minutes and hours are handled separately as
+// they're not calendar based
+var intervalSteps = map[string][3]int{
+	"minute": {0, 0, 0},
+	"hour":   {0, 0, 0},
+	"day":    {0, 0, 1},
+	"week":   {0, 0, 7},
+	"month":  {0, 1, 0},
+}
+
+// addIntervals adds n intervals to the passed time
+func addIntervals(t time.Time, interval string, n int) time.Time {
+	switch interval {
+	case "minute":
+		return t.Add(time.Duration(n) * time.Minute)
+	case "hour":
+		return t.Add(time.Duration(n) * time.Hour)
+	}
+	step := intervalSteps[interval]
+	return t.AddDate(step[0]*n, step[1]*n, step[2]*n)
+}
+
+// truncateInterval returns the start of the interval the passed
+// time occurs in. All intervals are aligned in UTC and weeks
+// begin on Monday
+func truncateInterval(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	switch interval {
+	case "minute":
+		return t.Truncate(time.Minute)
+	case "hour":
+		return t.Truncate(time.Hour)
+	case "day":
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case "week":
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return t
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+func TestActionSeries(t *testing.T) {
+	s, e := newTestService(t)
+	app := createTestApp(t, e, "")
+	dayApp := createTestApp(t, e, "resolution=day")
+
+	// Seed the first and third hour of a day
+	day := time.Date(2018, time.January, 2, 0, 0, 0, 0, time.UTC)
+	for _, seed := range []struct {
+		hours int
+		tags  string
+		count int
+	}{
+		{0, "platform:ios", 2},
+		{2, "platform:ios", 3},
+		{2, "platform:android", 4},
+	} {
+		tags, _ := models.ParseTags(seed.tags)
+		if err := s.store.IncrementAction(app.ID, "signup", tags, seed.count,
+			day.Add(time.Duration(seed.hours)*time.Hour)); err != nil {
+			t.Fatalf("Failed to seed Actions: %v", err)
+		}
+	}
+	path := fmt.Sprintf("/v1/app/%s/action/signup/series?from=%d&to=%d",
+		app.ID, day.Unix(), day.Add(4*time.Hour).Unix())
+
+	// Every interval is returned, including those without actions
+	var series []models.SeriesPoint
+	if code := testRequest(t, e, http.MethodGet, path+"&interval=hour", "", nil, &series); code != http.StatusOK {
+		t.Fatalf("Expected ActionSeries to return 200, got %d", code)
+	}
+	expected := []int64{2, 0, 7, 0}
+	if len(series) != len(expected) {
+		t.Fatalf("Expected %d points, got %+v", len(expected), series)
+	}
+	for i, point := range series {
+		if !point.Timestamp.Equal(day.Add(time.Duration(i)*time.Hour)) || point.Count != expected[i] {
+			t.Errorf("Expected point %d to have a count of %d, got %+v", i, expected[i], point)
+		}
+	}
+
+	// A series is returned for every value of the group_by key
+	var grouped map[string][]models.SeriesPoint
+	if code := testRequest(t, e, http.MethodGet, path+"&group_by=platform", "",
+		nil, &grouped); code != http.StatusOK {
+		t.Fatalf("Expected a grouped ActionSeries to return 200, got %d", code)
+	}
+	if len(grouped["ios"]) != 4 || grouped["ios"][2].Count != 3 || grouped["android"][2].Count != 4 {
+		t.Errorf("Expected a series for each platform, got %+v", grouped)
+	}
+
+	// Unknown, too fine and too many intervals are rejected
+	for _, path := range []string{
+		path + "&interval=fortnight",
+		fmt.Sprintf("/v1/app/%s/action/signup/series?interval=hour", dayApp.ID),
+		fmt.Sprintf("/v1/app/%s/action/signup/series?interval=minute&from=%d&to=%d",
+			app.ID, day.Unix(), day.Add(24*time.Hour).Unix()),
+	} {
+		if code := testRequest(t, e, http.MethodGet, path, "", nil, nil); code != http.StatusBadRequest {
+			t.Errorf("Expected GET %s to return 400, got %d", path, code)
+		}
+	}
+}
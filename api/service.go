@@ -4,8 +4,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/mysql"
 	"github.com/patrickmn/go-cache"
 	"github.com/sirupsen/logrus"
 )
@@ -16,10 +14,35 @@ type Service struct {
 	appID   string // tinystatAppID
 	rateMap *rateMap
 	maxApps int
-	db      *gorm.DB
+	store   Store
 	cache   *cache.Cache
+	appExp  time.Duration // How long Apps are cached for
+	rollups []*rollupLevel
+	done    chan struct{} // closed to stop background workers
+
+	adminToken string        // Authenticates app management, empty disables it
+	tokenGrace time.Duration // How long rotated tokens remain valid by default
+
+	maxSkew     time.Duration // How far in the future events may be
+	maxBackfill time.Duration // How far in the past events may be
 }
 
+const (
+	// defaultMaxSkew is how far in the future event timestamps may be
+	// unless configured otherwise
+	defaultMaxSkew = time.Minute * 5
+	// defaultMaxBackfill is how far in the past event timestamps may
+	// be unless configured otherwise
+	defaultMaxBackfill = time.Hour * 24
+	// defaultTokenGrace is how long a rotated token remains valid
+	// unless configured or requested otherwise
+	defaultTokenGrace = time.Hour * 24
+	// maxAppCacheExp is the longest Apps are cached for, bounding how
+	// long other servers keep accepting a rotated token after its
+	// grace period or serving a deleted or changed App
+	maxAppCacheExp = time.Minute
+)
+
 // rateMap is a a wrapper struct for performing rate-limiting
 type rateMap struct {
 	sync.Mutex
@@ -27,18 +50,15 @@ type rateMap struct {
 }
 
 // NewService generates a new Service reference and return it
-func NewService(logger *logrus.Logger, tinystatAppID string, mysqlURL string, maxApps int, cacheExp time.Duration) (*Service, error) {
+func NewService(logger *logrus.Logger, tinystatAppID string, store Store, maxApps int, cacheExp time.Duration) (*Service, error) {
 	l := logger.WithField("module", "new_service")
 
-	// Create the MySQL Client and AutoMigrate tables
-	l.Debug("Creating new MySQL Client")
-	db, err := gorm.Open("mysql", mysqlURL)
-	if err != nil {
-		l.WithError(err).Error("Failed to connect to MySQL")
-		return nil, err
+	// Apps are cached for no longer than the max so that changes made
+	// on other servers are seen
+	appExp := cacheExp
+	if appExp > maxAppCacheExp {
+		appExp = maxAppCacheExp
 	}
-	db.Set("gorm:table_options", "CHARSET=utf8").AutoMigrate(&Action{})
-	db.Set("gorm:table_options", "CHARSET=utf8").AutoMigrate(&App{})
 
 	// Return the new Service
 	l.Debug("Returning new service")
@@ -47,10 +67,39 @@ func NewService(logger *logrus.Logger, tinystatAppID string, mysqlURL string, ma
 		appID:   tinystatAppID,
 		rateMap: &rateMap{ipMap: make(map[string]time.Time)},
 		maxApps: maxApps,
-		db:      db,
+		store:   store,
 		cache:   cache.New(cacheExp, cacheExp),
+		appExp:  appExp,
+		done:    make(chan struct{}),
+
+		tokenGrace: defaultTokenGrace,
+
+		maxSkew:     defaultMaxSkew,
+		maxBackfill: defaultMaxBackfill,
 	}, nil
 }
 
-// Close closes the db connection
-func (s *Service) Close() error { return s.db.Close() }
+// SetTimestampWindow sets how far in the future (maxSkew) and past
+// (maxBackfill) submitted event timestamps may be
+func (s *Service) SetTimestampWindow(maxSkew, maxBackfill time.Duration) {
+	s.maxSkew = maxSkew
+	s.maxBackfill = maxBackfill
+}
+
+// SetAdminToken sets the token required to manage Apps. If it's
+// empty app management is disabled
+func (s *Service) SetAdminToken(token string) {
+	s.adminToken = token
+}
+
+// SetTokenGracePeriod sets how long an Apps previous token remains
+// valid after rotating it when no grace period is requested
+func (s *Service) SetTokenGracePeriod(grace time.Duration) {
+	s.tokenGrace = grace
+}
+
+// Close stops all background workers and closes the underlying Store
+func (s *Service) Close() error {
+	close(s.done)
+	return s.store.Close()
+}
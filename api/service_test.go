@@ -0,0 +1,107 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/sirupsen/logrus"
+)
+
+// testAdminToken authenticates app management in tests
+const testAdminToken = "test-admin-token"
+
+// testRequests counts every test request so each is sent from its own
+// IP and never rate limited
+var testRequests uint32
+
+// newTestService generates a Service backed by a memoryStore along
+// with its router
+func newTestService(t *testing.T) (*Service, *echo.Echo) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	s, err := NewService(logger, "", NewMemoryStore(), 100, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create Service: %v", err)
+	}
+	s.SetAdminToken(testAdminToken)
+	return s, s.Router()
+}
+
+// testRequest performs a request against the router authenticated
+// with token, sending in as JSON and decoding a 200 response into
+// out. The status code of the response is returned
+func testRequest(t *testing.T, e *echo.Echo, method, path, token string, in, out interface{}) int {
+	t.Helper()
+	rec := serveTestRequest(t, e, method, path, token, in)
+	if rec.Code == http.StatusOK && out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("Failed to decode %s %s response %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+// serveTestRequest performs a request against the router
+// authenticated with token, sending in as JSON, and returns the
+// recorded response
+func serveTestRequest(t *testing.T, e *echo.Echo, method, path, token string, in interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var body io.Reader
+	if in != nil {
+		jsonBytes, err := json.Marshal(in)
+		if err != nil {
+			t.Fatalf("Failed to encode request body: %v", err)
+		}
+		body = bytes.NewReader(jsonBytes)
+	}
+
+	n := atomic.AddUint32(&testRequests, 1)
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set(echo.HeaderXRealIP, fmt.Sprintf("10.%d.%d.%d", n>>16&255, n>>8&255, n&255))
+	if in != nil {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	if token != "" {
+		req.Header.Set("TOKEN", token)
+	}
+	if token == testAdminToken {
+		req.Header.Set("ADMIN-TOKEN", token)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// createTestApp creates an App through the API with the passed query,
+// returning it along with its token
+func createTestApp(t *testing.T, e *echo.Echo, query string) *App {
+	t.Helper()
+	var app App
+	if code := testRequest(t, e, http.MethodPost, "/v1/app/create/test?"+query,
+		testAdminToken, nil, &app); code != http.StatusOK {
+		t.Fatalf("Expected CreateApp to return 200, got %d", code)
+	}
+	if app.Token == "" {
+		t.Fatal("Expected CreateApp to return the Apps token")
+	}
+	return &app
+}
+
+// testCount retrieves an int64 count from the passed path
+func testCount(t *testing.T, e *echo.Echo, path, token string) int64 {
+	t.Helper()
+	var count int64
+	if code := testRequest(t, e, http.MethodGet, path, token, nil, &count); code != http.StatusOK {
+		t.Fatalf("Expected GET %s to return 200, got %d", path, code)
+	}
+	return count
+}
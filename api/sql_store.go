@@ -0,0 +1,750 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sdwolfe32/tinystat/models"
+	"github.com/sdwolfe32/tinystat/sketch"
+)
+
+// bucketTables are the tables of every bucketed metric, all of
+// which contain the columns id, app_id and timestamp
+var bucketTables = []string{"actions", "uniques", "gauges", "distributions"}
+
+// tagsLength is the length of the tags column of the actions table
+const tagsLength = 329
+
+// sqlStore is a Store backed by a SQL database through gorm.
+// Dialect specific queries are provided by each backends constructor.
+// All timestamps are stored in UTC so that backends comparing them
+// as strings (SQLite) order them correctly
+type sqlStore struct {
+	db *gorm.DB
+	// incrementActionSQL upserts an Action and must accept the
+	// arguments id, app_id, action, tags, count, timestamp
+	incrementActionSQL string
+	// purgeBucketsSQL deletes a limited number of buckets from the
+	// table named by %[1]s and must accept the arguments app_id,
+	// timestamp, limit
+	purgeBucketsSQL string
+	// lockRowsOption is appended to the query reading a unique, gauge
+	// or distribution bucket to lock it until merged (ex: FOR UPDATE),
+	// and may be empty if transactions are already serialized
+	lockRowsOption string
+	// isConflict reports whether an error was caused by inserting a
+	// duplicate primary key, and may be nil if that can't happen
+	// because transactions are serialized
+	isConflict func(err error) bool
+}
+
+// SumResult represents a sum query result
+type SumResult struct{ Total int64 }
+
+// IncrementAction executes the dialects upsert query for an Action
+func (s *sqlStore) IncrementAction(appID, action string, tags models.Tags, count int, timestamp time.Time) error {
+	key := generateKey(appID, action, tags.String(), timestamp)
+	return s.db.Exec(s.incrementActionSQL, key, appID, action,
+		tags.String(), count, timestamp.UTC()).Error
+}
+
+// IncrementActions executes the dialects upsert query for every
+// increment within a transaction
+func (s *sqlStore) IncrementActions(appID string, increments []ActionIncrement) error {
+	return s.transaction(func(tx *gorm.DB) error {
+		for _, inc := range increments {
+			key := generateKey(appID, inc.Action, inc.Tags.String(), inc.Timestamp)
+			if err := tx.Exec(s.incrementActionSQL, key, appID, inc.Action,
+				inc.Tags.String(), inc.Count, inc.Timestamp.UTC()).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SumActions will attempt to retrieve all actions matching the
+// filter and SUM them all to retrieve the total number of actions
+func (s *sqlStore) SumActions(filter ActionFilter) (int64, error) {
+	// Tags can only be matched after grouping by them
+	if len(filter.Tags) > 0 {
+		tagged, err := s.SumActionTags(filter)
+		var total int64
+		for _, t := range tagged {
+			total += t.Total
+		}
+		return total, err
+	}
+
+	var res SumResult
+	err := s.filterActions(filter).Select("sum(count) as total").Scan(&res).Error
+	return res.Total, err
+}
+
+// SumActionBuckets sums all actions matching the filter grouped
+// by their bucket timestamp and tags
+func (s *sqlStore) SumActionBuckets(filter ActionFilter) ([]BucketResult, error) {
+	var res []BucketResult
+	if err := s.filterActions(filter).Select("timestamp, tags, sum(count) as total").
+		Group("timestamp, tags").Order("timestamp").Scan(&res).Error; err != nil {
+		return nil, err
+	}
+
+	// Remove all buckets without the filters tags
+	matched := res[:0]
+	for _, b := range res {
+		if filter.matchesTags(b.Tags) {
+			matched = append(matched, b)
+		}
+	}
+	return matched, nil
+}
+
+// SumActionTags sums all actions matching the filter grouped
+// by their tags
+func (s *sqlStore) SumActionTags(filter ActionFilter) ([]TagsResult, error) {
+	var res []TagsResult
+	if err := s.filterActions(filter).Select("tags, sum(count) as total").
+		Group("tags").Scan(&res).Error; err != nil {
+		return nil, err
+	}
+
+	// Remove all sets of tags without the filters tags
+	matched := res[:0]
+	for _, t := range res {
+		if filter.matchesTags(t.Tags) {
+			matched = append(matched, t)
+		}
+	}
+	return matched, nil
+}
+
+// actionTotalResult represents an actionTotals query result
+type actionTotalResult struct {
+	Action    string
+	Total     int64
+	FirstSeen sqlTime
+	LastSeen  sqlTime
+}
+
+// ListActions totals every action matching the filter in a single
+// grouped query ordered by name
+func (s *sqlStore) ListActions(filter ActionFilter, limit, offset int) ([]models.ActionTotal, error) {
+	return s.actionTotals(filter, "action", limit, offset)
+}
+
+// TopActions totals every action matching the filter in a single
+// grouped query ordered by total
+func (s *sqlStore) TopActions(filter ActionFilter, limit, offset int) ([]models.ActionTotal, error) {
+	return s.actionTotals(filter, "total desc, action", limit, offset)
+}
+
+// actionTotals totals every action matching the filter, ignoring
+// tags, in a single grouped query ordered by the passed clause
+func (s *sqlStore) actionTotals(filter ActionFilter, order string, limit, offset int) ([]models.ActionTotal, error) {
+	filter.Tags = nil
+	var res []actionTotalResult
+	if err := s.filterActions(filter).
+		Select("action, sum(count) as total, min(timestamp) as first_seen, max(timestamp) as last_seen").
+		Group("action").Order(order).Limit(limit).Offset(offset).
+		Scan(&res).Error; err != nil {
+		return nil, err
+	}
+
+	totals := make([]models.ActionTotal, 0, len(res))
+	for _, r := range res {
+		totals = append(totals, models.ActionTotal{Action: r.Action, Total: r.Total,
+			FirstSeen: r.FirstSeen.Time, LastSeen: r.LastSeen.Time})
+	}
+	return totals, nil
+}
+
+// oldestResult represents an OldestBucket query result
+type oldestResult struct{ Oldest sqlTime }
+
+// OldestBucket returns the oldest timestamp of every bucket table
+func (s *sqlStore) OldestBucket() (time.Time, error) {
+	var oldest time.Time
+	for _, table := range bucketTables {
+		var res oldestResult
+		if err := s.db.Table(table).Select("min(timestamp) as oldest").
+			Scan(&res).Error; err != nil {
+			return time.Time{}, err
+		}
+		if !res.Oldest.IsZero() && (oldest.IsZero() || res.Oldest.Before(oldest)) {
+			oldest = res.Oldest.Time
+		}
+	}
+	return oldest, nil
+}
+
+// rollupGroup represents a single app, action and set of tags
+// being rolled up
+type rollupGroup struct {
+	AppID   string
+	Action  string
+	Tags    string
+	Total   int64
+	Buckets int64
+}
+
+// RollupActions replaces all buckets of each app, action and set of
+// tags within [start, end) with a single bucket in one transaction.
+// Unique, Gauge and Distribution buckets of each app and name are
+// merged the same way
+func (s *sqlStore) RollupActions(start, end time.Time) (int64, error) {
+	var removed int64
+	err := s.transaction(func(tx *gorm.DB) error {
+		// Find every app, action and set of tags with more than one
+		// bucket in range
+		var groups []rollupGroup
+		if err := tx.Model(&Action{}).
+			Select("app_id, action, tags, sum(count) as total, count(*) as buckets").
+			Where("timestamp >= ? AND timestamp < ?", start.UTC(), end.UTC()).
+			Group("app_id, action, tags").Having("count(*) > 1").
+			Scan(&groups).Error; err != nil {
+			return err
+		}
+
+		// Replace the buckets of each with their total
+		for _, g := range groups {
+			if err := tx.Where("app_id = ? AND action = ? AND tags = ? AND timestamp >= ? AND timestamp < ?",
+				g.AppID, g.Action, g.Tags, start.UTC(), end.UTC()).Delete(&Action{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&Action{
+				ID:        generateKey(g.AppID, g.Action, g.Tags, start),
+				AppID:     g.AppID,
+				Action:    g.Action,
+				Tags:      g.Tags,
+				Count:     g.Total,
+				Timestamp: start.UTC(),
+			}).Error; err != nil {
+				return err
+			}
+			removed += g.Buckets - 1
+		}
+
+		// Replace the unique buckets of each app and action with
+		// their merged sketch
+		var uniques []*Unique
+		if err := tx.Where("timestamp >= ? AND timestamp < ?", start.UTC(), end.UTC()).
+			Find(&uniques).Error; err != nil {
+			return err
+		}
+		merged, err := rollupUniques(uniques, start)
+		if err != nil {
+			return err
+		}
+		for _, u := range merged {
+			res := tx.Where("app_id = ? AND action = ? AND timestamp >= ? AND timestamp < ?",
+				u.AppID, u.Action, start.UTC(), end.UTC()).Delete(&Unique{})
+			if res.Error != nil {
+				return res.Error
+			}
+			if err := tx.Create(u).Error; err != nil {
+				return err
+			}
+			removed += res.RowsAffected - 1
+		}
+
+		// Replace the gauge buckets of each app and name with their
+		// merged samples
+		var gauges []*Gauge
+		if err := tx.Where("timestamp >= ? AND timestamp < ?", start.UTC(), end.UTC()).
+			Find(&gauges).Error; err != nil {
+			return err
+		}
+		for _, g := range rollupGauges(gauges, start) {
+			res := tx.Where("app_id = ? AND name = ? AND timestamp >= ? AND timestamp < ?",
+				g.AppID, g.Name, start.UTC(), end.UTC()).Delete(&Gauge{})
+			if res.Error != nil {
+				return res.Error
+			}
+			if err := tx.Create(g).Error; err != nil {
+				return err
+			}
+			removed += res.RowsAffected - 1
+		}
+
+		// Replace the distribution buckets of each app and action
+		// with their merged histogram
+		var distributions []*Distribution
+		if err := tx.Where("timestamp >= ? AND timestamp < ?", start.UTC(), end.UTC()).
+			Find(&distributions).Error; err != nil {
+			return err
+		}
+		mergedDists, err := rollupDistributions(distributions, start)
+		if err != nil {
+			return err
+		}
+		for _, d := range mergedDists {
+			res := tx.Where("app_id = ? AND action = ? AND timestamp >= ? AND timestamp < ?",
+				d.AppID, d.Action, start.UTC(), end.UTC()).Delete(&Distribution{})
+			if res.Error != nil {
+				return res.Error
+			}
+			if err := tx.Create(d).Error; err != nil {
+				return err
+			}
+			removed += res.RowsAffected - 1
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// PurgeActions executes the dialects limited delete query for an app
+// against every bucket table
+func (s *sqlStore) PurgeActions(appID string, before time.Time, limit int) (int64, error) {
+	var removed int64
+	for _, table := range bucketTables {
+		res := s.db.Exec(fmt.Sprintf(s.purgeBucketsSQL, table), appID, before.UTC(), limit)
+		if res.Error != nil {
+			return removed, res.Error
+		}
+		removed += res.RowsAffected
+	}
+	return removed, nil
+}
+
+// GetRollupState retrieves the stored progress of a rollup level
+func (s *sqlStore) GetRollupState(interval string) (*RollupState, error) {
+	state := RollupState{Name: interval}
+	err := s.db.Where("name = ?", interval).First(&state).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &state, nil
+	}
+	return &state, err
+}
+
+// SetRollupRolled updates the rolled mark of a rollup level, storing
+// its state if it has never run
+func (s *sqlStore) SetRollupRolled(interval string, rolled time.Time) error {
+	rolled = rolled.UTC()
+	return s.transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&RollupState{}).Where("name = ?", interval).Update("rolled", rolled)
+		if res.Error != nil || res.RowsAffected > 0 {
+			return res.Error
+		}
+		return tx.Create(&RollupState{Name: interval, Rolled: &rolled}).Error
+	})
+}
+
+// MarkRollupPending lowers the pending interval of a rollup level in
+// a single conditional update
+func (s *sqlStore) MarkRollupPending(interval string, start time.Time) error {
+	return s.db.Model(&RollupState{}).
+		Where("name = ? AND (pending IS NULL OR pending > ?)", interval, start.UTC()).
+		Update("pending", start.UTC()).Error
+}
+
+// ClearRollupPending clears the pending interval of a rollup level in
+// a single conditional update
+func (s *sqlStore) ClearRollupPending(interval string, pending time.Time) error {
+	return s.db.Model(&RollupState{}).
+		Where("name = ? AND pending = ?", interval, pending.UTC()).
+		Update("pending", gorm.Expr("NULL")).Error
+}
+
+// MergeUnique merges the HLL into the stored unique bucket while
+// holding a lock on it, as the bucket must be read, merged and written
+// back
+func (s *sqlStore) MergeUnique(appID, action string, hll *sketch.HLL, timestamp time.Time) error {
+	key := generateKey(appID, action, "", timestamp)
+	return s.mergeBucket(func(tx *gorm.DB) error {
+		var unique Unique
+		err := tx.Where("id = ?", key).First(&unique).Error
+		if gorm.IsRecordNotFoundError(err) {
+			unique = Unique{ID: key, AppID: appID, Action: action,
+				Timestamp: timestamp.UTC()}
+			if err := unique.merge(hll); err != nil {
+				return err
+			}
+			return tx.Create(&unique).Error
+		}
+		if err != nil {
+			return err
+		}
+		if err := unique.merge(hll); err != nil {
+			return err
+		}
+		return tx.Model(&unique).Update("sketch", unique.Sketch).Error
+	})
+}
+
+// UniqueSketch streams every unique bucket matching the filter,
+// merging them into a single HLL one at a time so a long range never
+// holds more than a single bucket in memory
+func (s *sqlStore) UniqueSketch(filter ActionFilter) (*sketch.HLL, error) {
+	rows, err := s.filterBuckets(&Unique{}, "action", filter).Select("sketch").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	merged := sketch.NewHLL()
+	for rows.Next() {
+		var unique Unique
+		if err := rows.Scan(&unique.Sketch); err != nil {
+			return nil, err
+		}
+		hll, err := unique.hll()
+		if err != nil {
+			return nil, err
+		}
+		merged.Merge(hll)
+	}
+	return merged, rows.Err()
+}
+
+// RecordGauge merges the samples into the stored gauge bucket while
+// holding a lock on it, as the bucket must be read, merged and written
+// back
+func (s *sqlStore) RecordGauge(appID, name string, samples models.Gauge, timestamp time.Time) error {
+	key := generateKey(appID, name, "", timestamp)
+	return s.mergeBucket(func(tx *gorm.DB) error {
+		var gauge Gauge
+		err := tx.Where("id = ?", key).First(&gauge).Error
+		if gorm.IsRecordNotFoundError(err) {
+			gauge = Gauge{ID: key, AppID: appID, Name: name, Timestamp: timestamp.UTC()}
+			gauge.merge(samples)
+			return tx.Create(&gauge).Error
+		}
+		if err != nil {
+			return err
+		}
+		gauge.merge(samples)
+		return tx.Save(&gauge).Error
+	})
+}
+
+// AggregateGauge aggregates the min, max, sum and samples of every
+// gauge bucket matching the filter and takes last from the most
+// recently sampled bucket
+func (s *sqlStore) AggregateGauge(filter ActionFilter) (models.Gauge, error) {
+	var res models.Gauge
+	if err := s.filterBuckets(&Gauge{}, "name", filter).
+		Select("min(min) as min, max(max) as max, sum(sum) as sum, sum(samples) as samples").
+		Scan(&res).Error; err != nil || res.Samples == 0 {
+		return models.Gauge{}, err
+	}
+
+	var last Gauge
+	if err := s.filterBuckets(&Gauge{}, "name", filter).
+		Order("last_at desc").First(&last).Error; err != nil {
+		return models.Gauge{}, err
+	}
+	res.Last, res.LastAt = last.Last, last.LastAt
+	return res, nil
+}
+
+// MergeDistribution merges the Histogram into the stored distribution
+// bucket while holding a lock on it, as the bucket must be read,
+// merged and written back
+func (s *sqlStore) MergeDistribution(appID, action string, hist *sketch.Histogram, timestamp time.Time) error {
+	key := generateKey(appID, action, "", timestamp)
+	return s.mergeBucket(func(tx *gorm.DB) error {
+		var dist Distribution
+		err := tx.Where("id = ?", key).First(&dist).Error
+		if gorm.IsRecordNotFoundError(err) {
+			dist = Distribution{ID: key, AppID: appID, Action: action,
+				Timestamp: timestamp.UTC()}
+			if err := dist.merge(hist); err != nil {
+				return err
+			}
+			return tx.Create(&dist).Error
+		}
+		if err != nil {
+			return err
+		}
+		if err := dist.merge(hist); err != nil {
+			return err
+		}
+		return tx.Model(&dist).Update("sketch", dist.Sketch).Error
+	})
+}
+
+// DistributionSketch streams every distribution bucket matching the
+// filter, merging them into a single Histogram one at a time so a
+// long range never holds more than a single bucket in memory
+func (s *sqlStore) DistributionSketch(filter ActionFilter) (*sketch.Histogram, error) {
+	rows, err := s.filterBuckets(&Distribution{}, "action", filter).Select("sketch").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	merged := sketch.NewHistogram()
+	for rows.Next() {
+		var distribution Distribution
+		if err := rows.Scan(&distribution.Sketch); err != nil {
+			return nil, err
+		}
+		hist, err := distribution.histogram()
+		if err != nil {
+			return nil, err
+		}
+		merged.Merge(hist)
+	}
+	return merged, rows.Err()
+}
+
+// filterActions begins a query on the actions table with all
+// non-zero values of the filter applied, except for tags which
+// must be matched after grouping by them
+func (s *sqlStore) filterActions(filter ActionFilter) *gorm.DB {
+	return s.filterBuckets(&Action{}, "action", filter)
+}
+
+// filterBuckets begins a query on the table of the passed bucket
+// model with the app, time range and action of the filter applied.
+// The action is matched against nameColumn
+func (s *sqlStore) filterBuckets(model interface{}, nameColumn string, filter ActionFilter) *gorm.DB {
+	query := s.db.Model(model)
+	if filter.AppID != "" {
+		query = query.Where("app_id = ?", filter.AppID)
+	}
+	if filter.Action != "" {
+		query = query.Where(nameColumn+" = ?", filter.Action)
+	}
+	if filter.Prefix != "" {
+		query = query.Where(nameColumn+" LIKE ? ESCAPE '!'", likePrefix(filter.Prefix))
+	}
+	if !filter.Start.IsZero() {
+		query = query.Where("timestamp >= ?", filter.Start.UTC())
+	}
+	if !filter.End.IsZero() {
+		query = query.Where("timestamp < ?", filter.End.UTC())
+	}
+	return query
+}
+
+// CreateApp inserts a new App
+func (s *sqlStore) CreateApp(app *App) error { return s.db.Create(app).Error }
+
+// GetApp retrieves an App by its ID
+func (s *sqlStore) GetApp(appID string) (*App, error) {
+	var app App
+	if err := s.db.Where(&App{ID: appID}).First(&app).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &app, nil
+}
+
+// UpdateApp saves all fields of an existing App
+func (s *sqlStore) UpdateApp(app *App) error { return s.db.Save(app).Error }
+
+// ListApps retrieves every App
+func (s *sqlStore) ListApps() ([]*App, error) {
+	var apps []*App
+	return apps, s.db.Find(&apps).Error
+}
+
+// DeleteApp removes an App, all of its buckets and all of its Keys in
+// a single transaction
+func (s *sqlStore) DeleteApp(appID string) error {
+	return s.transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("app_id = ?", appID).Delete(&Action{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("app_id = ?", appID).Delete(&Unique{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("app_id = ?", appID).Delete(&Gauge{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("app_id = ?", appID).Delete(&Distribution{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("app_id = ?", appID).Delete(&Key{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", appID).Delete(&App{}).Error
+	})
+}
+
+// CountApps returns the number of Apps, optionally only those
+// created by the passed IP
+func (s *sqlStore) CountApps(ip string) (int64, error) {
+	var count int64
+	return count, s.db.Model(&App{}).Where(&App{IP: ip}).Count(&count).Error
+}
+
+// CreateKey inserts a new Key
+func (s *sqlStore) CreateKey(key *Key) error { return s.db.Create(key).Error }
+
+// GetKey retrieves a Key by its ID
+func (s *sqlStore) GetKey(keyID string) (*Key, error) {
+	var key Key
+	if err := s.db.Where("id = ?", keyID).First(&key).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+// UpdateKey saves all fields of an existing Key
+func (s *sqlStore) UpdateKey(key *Key) error { return s.db.Save(key).Error }
+
+// ListKeys retrieves every Key of the passed app ordered by creation
+func (s *sqlStore) ListKeys(appID string) ([]*Key, error) {
+	var keys []*Key
+	return keys, s.db.Where("app_id = ?", appID).Order("created_at, id").Find(&keys).Error
+}
+
+// migrate creates or updates all tables and indexes needed by a
+// sqlStore. tagsLengthSQL selects the length of the tags column of
+// the actions table, and widenTagsSQL widens it if it was created too
+// narrow for every canonical set of tags. Both may be empty if the
+// dialect doesn't enforce column lengths
+func migrate(db *gorm.DB, tagsLengthSQL, widenTagsSQL string) error {
+	if err := db.AutoMigrate(&Action{}, &Unique{}, &Gauge{}, &Distribution{},
+		&App{}, &Key{}, &RollupState{}).Error; err != nil {
+		return err
+	}
+	if tagsLengthSQL != "" {
+		if err := widenTags(db, tagsLengthSQL, widenTagsSQL); err != nil {
+			return err
+		}
+	}
+	if err := hashAppTokens(db); err != nil {
+		return err
+	}
+	if err := db.Model(&Action{}).AddIndex("idx_actions_app_id_action_timestamp",
+		"app_id", "action", "timestamp").Error; err != nil {
+		return err
+	}
+	if err := db.Model(&Unique{}).AddIndex("idx_uniques_app_id_action_timestamp",
+		"app_id", "action", "timestamp").Error; err != nil {
+		return err
+	}
+	if err := db.Model(&Gauge{}).AddIndex("idx_gauges_app_id_name_timestamp",
+		"app_id", "name", "timestamp").Error; err != nil {
+		return err
+	}
+	return db.Model(&Distribution{}).AddIndex("idx_distributions_app_id_action_timestamp",
+		"app_id", "action", "timestamp").Error
+}
+
+// widenTags widens the tags column of the actions table only if it's
+// narrower than tagsLength, as altering it may rebuild the table
+func widenTags(db *gorm.DB, tagsLengthSQL, widenTagsSQL string) error {
+	var length *int64
+	if err := db.Raw(tagsLengthSQL).Row().Scan(&length); err != nil {
+		return err
+	}
+	if length == nil || *length >= tagsLength {
+		return nil
+	}
+	return db.Exec(widenTagsSQL).Error
+}
+
+// hashAppTokens replaces the plaintext tokens of every App stored
+// before tokens were hashed (or inserted by hand) with salted hashes.
+// Only those Apps are read, and only their token columns are updated
+func hashAppTokens(db *gorm.DB) error {
+	var apps []*App
+	if err := db.Select("id, token, previous_token, token_salt, token_hash, previous_token_hash").
+		Where("token <> '' OR previous_token <> ''").Find(&apps).Error; err != nil {
+		return err
+	}
+	for _, app := range apps {
+		app.hashLegacyTokens()
+		if err := db.Model(&App{}).Where("id = ?", app.ID).Updates(map[string]interface{}{
+			"token":               app.Token,
+			"previous_token":      app.PreviousToken,
+			"token_salt":          app.TokenSalt,
+			"token_hash":          app.TokenHash,
+			"previous_token_hash": app.PreviousTokenHash,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the db connection
+func (s *sqlStore) Close() error { return s.db.Close() }
+
+// likePrefix escapes the passed prefix for use in a LIKE pattern
+// with '!' as the escape character, matching anything starting with it
+func likePrefix(prefix string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(prefix) + "%"
+}
+
+// sqlTime is a time.Time that can also be scanned from the strings
+// SQLite returns for aggregates of timestamp columns
+type sqlTime struct{ time.Time }
+
+// sqliteTimeFormats are the formats SQLite timestamps may be stored in
+var sqliteTimeFormats = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+}
+
+// Scan implements the sql.Scanner interface
+func (t *sqlTime) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		t.Time = time.Time{}
+		return nil
+	case time.Time:
+		t.Time = v.UTC()
+		return nil
+	case []byte:
+		return t.parse(string(v))
+	case string:
+		return t.parse(v)
+	}
+	return fmt.Errorf("Unsupported timestamp type %T", value)
+}
+
+// parse parses a timestamp in any of the SQLite formats
+func (t *sqlTime) parse(value string) error {
+	for _, format := range sqliteTimeFormats {
+		if parsed, err := time.Parse(format, value); err == nil {
+			t.Time = parsed.UTC()
+			return nil
+		}
+	}
+	return fmt.Errorf("Failed to parse timestamp %q", value)
+}
+
+// mergeBucket runs the read-modify-write of a single bucket in a
+// transaction whose reads lock the rows they return. If another
+// writer creates the bucket first the merge is retried once, now
+// locking the existing bucket
+func (s *sqlStore) mergeBucket(merge func(tx *gorm.DB) error) error {
+	locked := func(tx *gorm.DB) error {
+		return merge(tx.Set("gorm:query_option", s.lockRowsOption))
+	}
+	err := s.transaction(locked)
+	if err != nil && s.isConflict != nil && s.isConflict(err) {
+		err = s.transaction(locked)
+	}
+	return err
+}
+
+// transaction executes fn within a transaction, committing if it
+// succeeds and rolling back otherwise
+func (s *sqlStore) transaction(fn func(tx *gorm.DB) error) error {
+	tx := s.db.Begin()
+	if err := tx.Error; err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// NewSQLiteStore opens (or creates) the SQLite database file at the
+// passed path, migrates all tables and returns it as a Store
+func NewSQLiteStore(path string) (Store, error) {
+	db, err := gorm.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows a single writer, so serialize all access
+	// to prevent "database is locked" errors. This also serializes
+	// every bucket merge so rows never need to be locked
+	db.DB().SetMaxOpenConns(1)
+	if err := migrate(db, "", ""); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqlStore{
+		db:                 db,
+		incrementActionSQL: `INSERT INTO actions(id, app_id, action, tags, count, timestamp) VALUES(?, ?, ?, ?, ?, ?) ON CONFLICT(id) DO UPDATE SET count = count + excluded.count`,
+		purgeBucketsSQL:    `DELETE FROM %[1]s WHERE id IN (SELECT id FROM %[1]s WHERE app_id = ? AND timestamp < ? LIMIT ?)`,
+	}, nil
+}
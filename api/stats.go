@@ -29,15 +29,18 @@ func (s *Service) Stats(c echo.Context) error {
 	l.Debug("Retrieving Tinystat stats")
 	var g errgroup.Group
 	var stats Stats
-	g.Go(func() error { return s.db.Model(&App{}).Count(&stats.Apps).Error })
+	g.Go(func() (err error) {
+		stats.Apps, err = s.store.CountApps("")
+		return err
+	})
 	g.Go(func() error {
-		return s.actionSum(&stats.ActionsRecorded, "app_id = ?", s.appID, "action = ?", "create-action")
+		return s.actionSum(&stats.ActionsRecorded, ActionFilter{AppID: s.appID, Action: "create-action"})
 	})
 	g.Go(func() error {
-		return s.actionSum(&stats.CountsCalculated, "app_id = ?", s.appID, "action = ?", "action-count")
+		return s.actionSum(&stats.CountsCalculated, ActionFilter{AppID: s.appID, Action: "action-count"})
 	})
 	g.Go(func() error {
-		return s.actionSum(&stats.SummariesCalculated, "app_id = ?", s.appID, "action = ?", "action-summary")
+		return s.actionSum(&stats.SummariesCalculated, ActionFilter{AppID: s.appID, Action: "action-summary"})
 	})
 	if err := g.Wait(); err != nil {
 		l.WithError(err).Error("Failed to retrieve overall stats")
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/sdwolfe32/tinystat/models"
+	"github.com/sdwolfe32/tinystat/sketch"
+)
+
+// ErrNotFound is returned by a Store when a requested record doesn't exist
+var ErrNotFound = errors.New("Record not found")
+
+// Store is the storage backend used by the Tinystat service to
+// persist Apps and the buckets of every metric type
+type Store interface {
+	// IncrementAction adds count to the Action bucket for the passed
+	// app, action, tags and timestamp, creating the bucket if it
+	// doesn't exist
+	IncrementAction(appID, action string, tags models.Tags, count int, timestamp time.Time) error
+	// IncrementActions applies every increment to the Action buckets
+	// of the passed app in a single transaction
+	IncrementActions(appID string, increments []ActionIncrement) error
+	// SumActions returns the total count of all Actions matching the filter
+	SumActions(filter ActionFilter) (int64, error)
+	// SumActionBuckets returns the total count of all Actions matching
+	// the filter for every stored bucket and set of tags, ordered by
+	// timestamp
+	SumActionBuckets(filter ActionFilter) ([]BucketResult, error)
+	// SumActionTags returns the total count of all Actions matching
+	// the filter for every stored set of tags
+	SumActionTags(filter ActionFilter) ([]TagsResult, error)
+	// ListActions returns the all-time total, first bucket and last
+	// bucket of every distinct action matching the filter ordered by
+	// name, skipping offset actions and returning at most limit.
+	// Tags are ignored so every action is totaled across all of them
+	ListActions(filter ActionFilter, limit, offset int) ([]models.ActionTotal, error)
+	// TopActions returns the total, first bucket and last bucket of
+	// every distinct action matching the filter ordered by total
+	// (highest first), skipping offset actions and returning at most
+	// limit. Tags are ignored the same as in ListActions
+	TopActions(filter ActionFilter, limit, offset int) ([]models.ActionTotal, error)
+	// OldestBucket returns the timestamp of the oldest stored bucket
+	// of any metric type, or the zero time if there are none
+	OldestBucket() (time.Time, error)
+	// RollupActions merges all Action buckets of each app, action and
+	// set of tags, and all Unique, Gauge and Distribution buckets of
+	// each app and name, within [start, end) into a single bucket
+	// timestamped at start, returning the number of buckets removed
+	RollupActions(start, end time.Time) (int64, error)
+	// PurgeActions deletes at most limit buckets of each metric type
+	// of the passed app with timestamps before the passed time,
+	// returning the number of buckets deleted
+	PurgeActions(appID string, before time.Time, limit int) (int64, error)
+	// GetRollupState returns the progress of the rollup level of the
+	// passed interval, which is empty if the level has never run
+	GetRollupState(interval string) (*RollupState, error)
+	// SetRollupRolled records that every interval of the passed level
+	// before rolled has been rolled up
+	SetRollupRolled(interval string, rolled time.Time) error
+	// MarkRollupPending records that the rolled up interval of the
+	// passed level beginning at start must be rolled up again,
+	// keeping the earliest pending interval
+	MarkRollupPending(interval string, start time.Time) error
+	// ClearRollupPending clears the pending interval of the passed
+	// level if it's still the passed one
+	ClearRollupPending(interval string, pending time.Time) error
+	// MergeUnique merges the passed HLL into the Unique bucket for the
+	// passed app, action and timestamp, creating the bucket if it
+	// doesn't exist
+	MergeUnique(appID, action string, hll *sketch.HLL, timestamp time.Time) error
+	// UniqueSketch returns the union of every Unique bucket matching
+	// the filter. Tags are ignored as Uniques aren't tagged
+	UniqueSketch(filter ActionFilter) (*sketch.HLL, error)
+	// RecordGauge merges the passed samples into the Gauge bucket for
+	// the passed app, gauge name and timestamp, creating the bucket if
+	// it doesn't exist
+	RecordGauge(appID, name string, samples models.Gauge, timestamp time.Time) error
+	// AggregateGauge merges the samples of every Gauge bucket matching
+	// the filter, whose Action is the gauge name. Tags are ignored as
+	// Gauges aren't tagged
+	AggregateGauge(filter ActionFilter) (models.Gauge, error)
+	// MergeDistribution merges the passed Histogram into the
+	// Distribution bucket for the passed app, action and timestamp,
+	// creating the bucket if it doesn't exist
+	MergeDistribution(appID, action string, hist *sketch.Histogram, timestamp time.Time) error
+	// DistributionSketch returns the union of every Distribution
+	// bucket matching the filter. Tags are ignored as Distributions
+	// aren't tagged
+	DistributionSketch(filter ActionFilter) (*sketch.Histogram, error)
+
+	// CreateApp stores a new App
+	CreateApp(app *App) error
+	// GetApp retrieves an App by its ID
+	GetApp(appID string) (*App, error)
+	// UpdateApp saves all fields of an existing App
+	UpdateApp(app *App) error
+	// ListApps retrieves every App
+	ListApps() ([]*App, error)
+	// DeleteApp removes an App, all of its buckets and all of its Keys
+	DeleteApp(appID string) error
+	// CountApps returns the number of Apps created by the passed IP.
+	// If ip is empty all Apps are counted
+	CountApps(ip string) (int64, error)
+
+	// CreateKey stores a new Key
+	CreateKey(key *Key) error
+	// GetKey retrieves a Key by its ID
+	GetKey(keyID string) (*Key, error)
+	// UpdateKey saves all fields of an existing Key
+	UpdateKey(key *Key) error
+	// ListKeys retrieves every Key of the passed app ordered by
+	// creation
+	ListKeys(appID string) ([]*Key, error)
+
+	// Close releases any resources held by the Store
+	Close() error
+}
+
+// ActionFilter narrows down the Actions a Store operates on.
+// Zero values are ignored
+type ActionFilter struct {
+	AppID  string
+	Action string
+	Start  time.Time   // Inclusive
+	End    time.Time   // Exclusive
+	Tags   models.Tags // Actions must have all of these tags
+	Prefix string      // Action names must start with this
+}
+
+// BucketResult is the total count of a single stored bucket
+type BucketResult struct {
+	Timestamp time.Time
+	Tags      string
+	Total     int64
+}
+
+// TagsResult is the total count of a single set of tags
+type TagsResult struct {
+	Tags  string
+	Total int64
+}
+
+// matches reports whether the passed Action satisfies the filter
+func (f ActionFilter) matches(a *Action) bool {
+	return f.matchesBucket(a.AppID, a.Action, a.Timestamp) && f.matchesTags(a.Tags)
+}
+
+// matchesBucket reports whether a bucket of the passed app, action
+// and timestamp satisfies the filter, ignoring tags
+func (f ActionFilter) matchesBucket(appID, action string, timestamp time.Time) bool {
+	return (f.AppID == "" || appID == f.AppID) &&
+		(f.Action == "" || action == f.Action) &&
+		strings.HasPrefix(action, f.Prefix) &&
+		(f.Start.IsZero() || !timestamp.Before(f.Start)) &&
+		(f.End.IsZero() || timestamp.Before(f.End))
+}
+
+// matchesTags reports whether the passed canonical tags contain
+// every tag of the filter
+func (f ActionFilter) matchesTags(tags string) bool {
+	if len(f.Tags) == 0 {
+		return true
+	}
+	parsed, err := models.ParseTags(tags)
+	return err == nil && parsed.Matches(f.Tags)
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/sdwolfe32/tinystat/models"
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrInvalidTags is thrown when we fail to parse the tags of a request
+var ErrInvalidTags = echo.NewHTTPError(http.StatusBadRequest,
+	"Tags must be at most 5 key:value pairs using only letters, digits, '.', '_' and '-'")
+
+// parseTagQuery parses the tags and group_by query params of a
+// request. Tags are formatted as key:value,key:value and group_by
+// is a single tag key
+func parseTagQuery(c echo.Context) (models.Tags, string, error) {
+	tags, err := models.ParseTags(c.QueryParam("tags"))
+	if err != nil {
+		return nil, "", ErrInvalidTags
+	}
+	return tags, c.QueryParam("group_by"), nil
+}
+
+// tagValue returns the value of key within the canonical tags. Actions
+// without the key (or with unparseable tags) are grouped under ""
+func tagValue(tags, key string) string {
+	parsed, err := models.ParseTags(tags)
+	if err != nil {
+		return ""
+	}
+	return parsed[key]
+}
+
+// groupedActionSum retrieves all actions matching the filter and
+// SUMs them for every value of the passed tag key
+func (s *Service) groupedActionSum(out *map[string]int64, filter ActionFilter, key string) error {
+	tagged, err := s.store.SumActionTags(filter)
+	if err != nil {
+		return err
+	}
+	totals := make(map[string]int64)
+	for _, t := range tagged {
+		totals[tagValue(t.Tags, key)] += t.Total
+	}
+	*out = totals
+	return nil
+}
+
+// timedGroupedActionSum returns a grouped sum only occuring in or
+// after the bucket containing the passed time
+func (s *Service) timedGroupedActionSum(out *map[string]int64, app *App, filter ActionFilter, startTime time.Time, key string) error {
+	filter.Start = s.bucketStart(app, startTime)
+	return s.groupedActionSum(out, filter, key)
+}
+
+// groupedSummary retrieves an ActionSummary for every value of the
+// passed tag key
+func (s *Service) groupedSummary(app *App, filter ActionFilter, starts summaryStarts, key string) (map[string]*models.ActionSummary, error) {
+	// Retrieve the grouped count of every window
+	var g errgroup.Group
+	var hour, day, week, month, year map[string]int64
+	g.Go(func() error { return s.timedGroupedActionSum(&hour, app, filter, starts.Hour, key) })
+	g.Go(func() error { return s.timedGroupedActionSum(&day, app, filter, starts.Day, key) })
+	g.Go(func() error { return s.timedGroupedActionSum(&week, app, filter, starts.Week, key) })
+	g.Go(func() error { return s.timedGroupedActionSum(&month, app, filter, starts.Month, key) })
+	g.Go(func() error { return s.timedGroupedActionSum(&year, app, filter, starts.Year, key) })
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	// Place every windows counts on the summary of their tag value
+	summaries := make(map[string]*models.ActionSummary)
+	summary := func(value string) *models.ActionSummary {
+		if _, ok := summaries[value]; !ok {
+			summaries[value] = &models.ActionSummary{}
+		}
+		return summaries[value]
+	}
+	for value, count := range hour {
+		summary(value).Hour = count
+	}
+	for value, count := range day {
+		summary(value).Day = count
+	}
+	for value, count := range week {
+		summary(value).Week = count
+	}
+	for value, count := range month {
+		summary(value).Month = count
+	}
+	for value, count := range year {
+		summary(value).Year = count
+	}
+	return summaries, nil
+}
+
+// groupedSeries builds a series for every value of the passed tag key
+func groupedSeries(buckets []BucketResult, start, end time.Time, interval, key string) map[string][]models.SeriesPoint {
+	groups := make(map[string][]BucketResult)
+	for _, b := range buckets {
+		value := tagValue(b.Tags, key)
+		groups[value] = append(groups[value], b)
+	}
+	series := make(map[string][]models.SeriesPoint)
+	for value, group := range groups {
+		series[value] = buildSeries(group, start, end, interval)
+	}
+	return series
+}
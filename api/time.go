@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+var (
+	// ErrParseTimeFailure is thrown when we fail to parse a time
+	ErrParseTimeFailure = echo.NewHTTPError(http.StatusBadRequest, "Failed to parse time, must be RFC3339 or unix seconds")
+	// ErrMissingTime is thrown when a required from time isn't passed
+	ErrMissingTime = echo.NewHTTPError(http.StatusBadRequest, "Missing required from time")
+	// ErrInvalidTimeRange is thrown when the start of a time range is not before its end
+	ErrInvalidTimeRange = echo.NewHTTPError(http.StatusBadRequest, "Time range start must be before its end")
+	// ErrInvalidTimestamp is thrown when an event is timestamped outside of the Apps accepted window
+	ErrInvalidTimestamp = echo.NewHTTPError(http.StatusBadRequest, "Timestamp is outside of the accepted window")
+)
+
+// parseTimeRange parses the from and to query params of a request.
+// A missing to defaults to the current time and a missing from is
+// generated by defaultFrom. If defaultFrom is nil, from is required
+func parseTimeRange(c echo.Context, defaultFrom func(to time.Time) time.Time) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+
+	// Parse the end of the range
+	to = time.Now()
+	if value := c.QueryParam("to"); value != "" {
+		if to, err = parseTime(value); err != nil {
+			return from, to, ErrParseTimeFailure
+		}
+	}
+
+	// Parse the start of the range
+	switch value := c.QueryParam("from"); {
+	case value != "":
+		if from, err = parseTime(value); err != nil {
+			return from, to, ErrParseTimeFailure
+		}
+	case defaultFrom != nil:
+		from = defaultFrom(to)
+	default:
+		return from, to, ErrMissingTime
+	}
+
+	// Verify the range isn't empty or inverted
+	if !from.Before(to) {
+		return from, to, ErrInvalidTimeRange
+	}
+	return from, to, nil
+}
+
+// parseTime parses a time formatted as either RFC3339
+// or as an integer number of seconds since the unix epoch
+func parseTime(value string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// eventTime returns the time an event occurred, defaulting to now if
+// it wasn't passed and rejecting it if it's further in the future or
+// past than the App allows
+func (s *Service) eventTime(app *App, timestamp, now time.Time) (time.Time, error) {
+	if timestamp.IsZero() {
+		return now, nil
+	}
+	maxSkew, maxBackfill := app.timestampWindow(s.maxSkew, s.maxBackfill)
+	if timestamp.After(now.Add(maxSkew)) || timestamp.Before(now.Add(-1*maxBackfill)) {
+		return time.Time{}, ErrInvalidTimestamp
+	}
+	return timestamp, nil
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/sdwolfe32/tinystat/client"
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+// maxTokenGrace is the longest an Apps previous token may remain
+// valid after rotating it
+const maxTokenGrace = time.Hour * 24 * 30
+
+var (
+	// ErrInvalidTokenGrace is thrown when a token grace period can't be parsed
+	ErrInvalidTokenGrace = echo.NewHTTPError(http.StatusBadRequest, "Grace must be a duration between 0 and 30d")
+	// ErrPreviousTokenRotation is thrown when a rotation is requested with a previous token
+	ErrPreviousTokenRotation = echo.NewHTTPError(http.StatusForbidden, "Tokens can only be rotated using the current token or an admin Key")
+)
+
+// RotateToken replaces the token of an App with a newly generated one.
+// The previous token remains valid for the passed grace period (ex:
+// 48h or 7d, defaults to the server default) so clients can be updated
+// without losing any actions. Passing a grace of 0 revokes it
+// immediately. Rotating again within the grace period revokes the
+// token that was previously rotated. Requires the current token or a
+// Key granted the admin scope
+// Endpoint: /app/:app_id/token/rotate?grace=:grace
+func (s *Service) RotateToken(c echo.Context) error {
+	l := s.logger.WithField("method", "rotate_token")
+	l.Debug("Received new RotateToken request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	l = l.WithField("app_id", appID)
+
+	// Parse the requested grace period
+	grace := s.tokenGrace
+	if value := c.QueryParam("grace"); value != "" {
+		var err error
+		if grace, err = parseWindowDuration(value); err != nil || grace < 0 || grace > maxTokenGrace {
+			l.WithError(err).Error("Failed to parse grace period")
+			return ErrInvalidTokenGrace
+		}
+	}
+	l = l.WithField("grace", grace)
+
+	// Retrieve the App from the DB, bypassing a possibly stale cache
+	l.Debug("Retrieving App from DB")
+	app, err := s.managedApp(appID)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return err
+	}
+
+	// Verify the request wasn't authenticated with a previous token
+	if _, ok := c.Get(keyContextKey).(*Key); !ok && !app.currentToken(requestToken(c)) {
+		l.WithError(ErrPreviousTokenRotation).Error("Rotation requested with previous token")
+		return ErrPreviousTokenRotation
+	}
+
+	// Generate the new token, keeping the current one for the grace period
+	l.Debug("Generating new App token")
+	app.hashLegacyTokens()
+	app.PreviousToken, app.PreviousTokenHash, app.PreviousTokenExpiresAt = "", "", nil
+	if grace > 0 {
+		expiresAt := time.Now().Add(grace)
+		app.PreviousTokenHash, app.PreviousTokenExpiresAt = app.TokenHash, &expiresAt
+	}
+	token := newUUID()
+	app.setToken(token)
+
+	// Store the App and replace the cached App with it
+	l.Debug("Storing rotated App in DB")
+	if err := s.store.UpdateApp(app); err != nil {
+		l.WithError(err).Error("Failed to store rotated App in DB")
+		return ErrAppUpdateFailure
+	}
+	s.cacheApp(app)
+
+	// Report the successful rotate-token to ourselves
+	go client.CreateAction("rotate-token")
+
+	// Return the new token
+	l.Debug("Returning successful RotateToken response")
+	return c.JSON(http.StatusOK, models.TokenRotation{Token: token,
+		PreviousTokenExpiresAt: app.PreviousTokenExpiresAt})
+}
@@ -0,0 +1,259 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/sdwolfe32/tinystat/client"
+	"github.com/sdwolfe32/tinystat/models"
+	"github.com/sdwolfe32/tinystat/sketch"
+)
+
+// maxUniqueIDs is the maximum number of identifiers that may be
+// submitted in a single CreateUnique request
+const maxUniqueIDs = 10000
+
+var (
+	// ErrInvalidUniqueIDs is thrown when we fail to decode submitted identifiers
+	ErrInvalidUniqueIDs = echo.NewHTTPError(http.StatusBadRequest, "Failed to decode unique identifiers")
+	// ErrTooManyUniqueIDs is thrown when too many identifiers are submitted at once
+	ErrTooManyUniqueIDs = echo.NewHTTPError(http.StatusBadRequest, "Too many unique identifiers (max 10000)")
+	// ErrUniqueMergeFailure is thrown when we fail to store submitted identifiers
+	ErrUniqueMergeFailure = echo.NewHTTPError(http.StatusInternalServerError, "Failed to store unique identifiers")
+	// ErrUniqueCountFailure is thrown when we fail to retrieve a unique count
+	ErrUniqueCountFailure = echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve unique count")
+)
+
+// Unique is a HyperLogLog sketch of the distinct identifiers seen
+// for an action within a single bucket
+type Unique struct {
+	ID        string    `gorm:"primary_key"`
+	AppID     string    `gorm:"type:varchar(10);not null"`
+	Action    string    `gorm:"type:varchar(100);not null"`
+	Sketch    []byte    `gorm:"not null"`
+	Timestamp time.Time `sql:"index"`
+}
+
+// hll decodes the stored sketch, returning an empty HLL if the
+// bucket doesn't have one yet
+func (u *Unique) hll() (*sketch.HLL, error) {
+	hll := sketch.NewHLL()
+	if len(u.Sketch) == 0 {
+		return hll, nil
+	}
+	return hll, hll.UnmarshalBinary(u.Sketch)
+}
+
+// merge merges the passed HLL into the stored sketch
+func (u *Unique) merge(other *sketch.HLL) error {
+	hll, err := u.hll()
+	if err != nil {
+		return err
+	}
+	hll.Merge(other)
+	u.Sketch, err = hll.MarshalBinary()
+	return err
+}
+
+// CreateUnique adds identifiers to the unique count of an action
+// in the Apps current bucket. The body should be JSON formatted as
+// {"ids": ["id1", "id2"]}
+// Endpoint: /action/:app_id/action/:action/unique
+func (s *Service) CreateUnique(c echo.Context) error {
+	l := s.logger.WithField("method", "create_unique")
+	l.Debug("Received new CreateUnique request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	action := c.Param("action")
+	var req models.UniqueIDs
+	if err := c.Bind(&req); err != nil {
+		l.WithError(err).Error("Failed to decode unique identifiers")
+		return ErrInvalidUniqueIDs
+	}
+	if len(req.IDs) > maxUniqueIDs {
+		l.WithError(ErrTooManyUniqueIDs).Error("Too many unique identifiers")
+		return ErrTooManyUniqueIDs
+	}
+	l = l.WithFields(map[string]interface{}{
+		"app_id": appID, "action": action, "ids": len(req.IDs)})
+
+	// Retrieve the App to determine its bucket resolution
+	app, err := s.requestApp(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return ErrAppRetrievalFailure
+	}
+
+	// Sketch the identifiers and merge them into the database
+	l.Debug("Merging unique identifiers in DB")
+	hll := sketch.NewHLL()
+	for _, id := range req.IDs {
+		hll.Add(id)
+	}
+	if err := s.store.MergeUnique(app.ID, action, hll, app.bucket(time.Now())); err != nil {
+		l.WithError(err).Error("Failed to merge unique identifiers")
+		return ErrUniqueMergeFailure
+	}
+
+	// Report the successful create-unique to ourselves
+	go client.CreateAction("create-unique")
+
+	// Return a Status OK
+	l.Debug("Returning successful CreateUnique response")
+	return c.JSON(http.StatusOK, nil)
+}
+
+// UniqueCount retrieves the approximate number of distinct
+// identifiers submitted for an action in the passed duration.
+// Duration should match the same formatting as
+// https://golang.org/pkg/time/#ParseDuration
+// Endpoint: /action/:app_id/action/:action/unique/:duration
+func (s *Service) UniqueCount(c echo.Context) error {
+	l := s.logger.WithField("method", "unique_count")
+	l.Debug("Received new UniqueCount request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	action := c.Param("action")
+	duration := c.Param("duration")
+	l = l.WithFields(map[string]interface{}{
+		"app_id": appID, "action": action, "duration": duration})
+
+	// Parse the duration passed
+	l.Debug("Parsing the requested duration")
+	dur, err := time.ParseDuration(duration)
+	if err != nil {
+		l.WithError(err).Error("Failed to parse duration")
+		return ErrParseDurationFailure
+	}
+
+	// Retrieve the App to determine its bucket resolution
+	app, err := s.requestApp(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return ErrAppRetrievalFailure
+	}
+
+	// Retrieve the unique count from the DB and return
+	l.Debug("Retrieve the unique count from the DB")
+	var count models.UniqueCount
+	if err := s.uniqueCount(&count, ActionFilter{AppID: appID, Action: action,
+		Start: s.bucketStart(app, time.Now().Add(-1*dur))}); err != nil {
+		l.WithError(err).Error("Failed to retrieve unique count")
+		return ErrUniqueCountFailure
+	}
+
+	// Report the successful unique-count to ourselves
+	go client.CreateAction("unique-count")
+
+	// Return an Status OK
+	l.Debug("Returning successful UniqueCount response")
+	return c.JSON(http.StatusOK, count)
+}
+
+// UniqueRangeCount retrieves the approximate number of distinct
+// identifiers submitted for an action between two absolute times.
+// Times behave the same as in ActionRangeCount
+// Endpoint: /action/:app_id/action/:action/unique?from=:from&to=:to
+func (s *Service) UniqueRangeCount(c echo.Context) error {
+	l := s.logger.WithField("method", "unique_range_count")
+	l.Debug("Received new UniqueRangeCount request")
+
+	// Decode the request variables
+	appID := c.Param("app_id")
+	action := c.Param("action")
+	l = l.WithFields(map[string]interface{}{"app_id": appID, "action": action})
+
+	// Parse the requested time range
+	l.Debug("Parsing the requested time range")
+	from, to, err := parseTimeRange(c, nil)
+	if err != nil {
+		l.WithError(err).Error("Failed to parse time range")
+		return err
+	}
+	l = l.WithFields(map[string]interface{}{"from": from, "to": to})
+
+	// Retrieve the App to determine its bucket resolution
+	app, err := s.requestApp(c)
+	if err != nil {
+		l.WithError(err).Error("Failed to retrieve App")
+		return ErrAppRetrievalFailure
+	}
+
+	// Retrieve the unique count from the DB and return
+	l.Debug("Retrieve the unique count from the DB")
+	var count models.UniqueCount
+	if err := s.uniqueCount(&count, ActionFilter{AppID: appID, Action: action,
+		Start: s.bucketStart(app, from), End: to}); err != nil {
+		l.WithError(err).Error("Failed to retrieve unique count")
+		return ErrUniqueCountFailure
+	}
+
+	// Report the successful unique-range-count to ourselves
+	go client.CreateAction("unique-range-count")
+
+	// Return an Status OK
+	l.Debug("Returning successful UniqueRangeCount response")
+	return c.JSON(http.StatusOK, count)
+}
+
+// uniqueCount merges every unique bucket matching the filter and
+// estimates the number of distinct identifiers within them
+func (s *Service) uniqueCount(out *models.UniqueCount, filter ActionFilter) error {
+	hll, err := s.store.UniqueSketch(filter)
+	if err != nil {
+		return err
+	}
+	*out = models.UniqueCount{Count: hll.Count(), StandardError: sketch.HLLStandardError}
+	return nil
+}
+
+// mergeUniques merges the sketches of every passed unique bucket
+// into a single HLL
+func mergeUniques(uniques []*Unique) (*sketch.HLL, error) {
+	merged := sketch.NewHLL()
+	for _, u := range uniques {
+		hll, err := u.hll()
+		if err != nil {
+			return nil, err
+		}
+		merged.Merge(hll)
+	}
+	return merged, nil
+}
+
+// rollupUniques groups the passed unique buckets by app and action
+// and merges every group with more than one bucket into a single
+// bucket timestamped at start
+func rollupUniques(uniques []*Unique, start time.Time) ([]*Unique, error) {
+	groups := make(map[[2]string][]*Unique)
+	for _, u := range uniques {
+		group := [2]string{u.AppID, u.Action}
+		groups[group] = append(groups[group], u)
+	}
+
+	var merged []*Unique
+	for group, buckets := range groups {
+		if len(buckets) < 2 {
+			continue
+		}
+		hll, err := mergeUniques(buckets)
+		if err != nil {
+			return nil, err
+		}
+		data, err := hll.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		merged = append(merged, &Unique{
+			ID:        generateKey(group[0], group[1], "", start),
+			AppID:     group[0],
+			Action:    group[1],
+			Sketch:    data,
+			Timestamp: start.UTC(),
+		})
+	}
+	return merged, nil
+}
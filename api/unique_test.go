@@ -0,0 +1,39 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+func TestUniqueCount(t *testing.T) {
+	_, e := newTestService(t)
+	app := createTestApp(t, e, "")
+
+	// Submit two overlapping batches of identifiers to the same bucket
+	path := fmt.Sprintf("/v1/app/%s/action/page-view/unique", app.ID)
+	for _, batch := range [][2]int{{0, 6000}, {3000, 9000}} {
+		var in models.UniqueIDs
+		for i := batch[0]; i < batch[1]; i++ {
+			in.IDs = append(in.IDs, "user-"+strconv.Itoa(i))
+		}
+		if code := testRequest(t, e, http.MethodPost, path, app.Token, in, nil); code != http.StatusOK {
+			t.Fatalf("Expected CreateUnique to return 200, got %d", code)
+		}
+	}
+
+	// Only distinct identifiers are counted, within the standard error
+	var count models.UniqueCount
+	path = fmt.Sprintf("/v1/app/%s/action/page-view/unique/1h", app.ID)
+	if code := testRequest(t, e, http.MethodGet, path, "", nil, &count); code != http.StatusOK {
+		t.Fatalf("Expected UniqueCount to return 200, got %d", code)
+	}
+	relErr := math.Abs(float64(count.Count)-9000) / 9000
+	if count.StandardError == 0 || relErr > 3*count.StandardError {
+		t.Errorf("Expected a count within 3 standard errors of 9000, got %+v", count)
+	}
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/sdwolfe32/tinystat/models"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// maxSummaryWindows is the maximum number of windows a single
+	// ActionSummary may request
+	maxSummaryWindows = 20
+	// maxWindowDays is the maximum number of days a window may span
+	maxWindowDays = 3650
+)
+
+var (
+	// ErrInvalidWindows is thrown when the requested summary windows can't be parsed
+	ErrInvalidWindows = echo.NewHTTPError(http.StatusBadRequest,
+		"Windows must be a comma separated list of up to 20 positive durations of at most 3650d (ex: 15m,1h,30d)")
+	// ErrWindowsCombined is thrown when summary windows are combined with another summary option
+	ErrWindowsCombined = echo.NewHTTPError(http.StatusBadRequest,
+		"Windows can't be combined with calendar, compare or group_by")
+)
+
+// parseSummaryWindows parses a comma separated list of summary
+// windows, each formatted as either a Go duration or a whole number of
+// days (ex: 30d)
+func parseSummaryWindows(value string) ([]string, []time.Duration, error) {
+	names := strings.Split(value, ",")
+	if len(names) > maxSummaryWindows {
+		return nil, nil, ErrInvalidWindows
+	}
+	durations := make([]time.Duration, len(names))
+	for i, name := range names {
+		dur, err := parseWindowDuration(name)
+		if err != nil || dur <= 0 {
+			return nil, nil, ErrInvalidWindows
+		}
+		durations[i] = dur
+	}
+	return names, durations, nil
+}
+
+// parseWindowDuration parses a Go duration, additionally accepting a
+// whole number of days up to maxWindowDays suffixed with d
+func parseWindowDuration(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil {
+			return 0, err
+		}
+		if days > maxWindowDays {
+			return 0, ErrInvalidWindows
+		}
+		return time.Duration(days) * time.Hour * 24, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// windowedSummary retrieves the count of every window, each ending
+// now, concurrently and returns them keyed by window name
+func (s *Service) windowedSummary(app *App, filter ActionFilter, now time.Time, names []string, durations []time.Duration) (models.WindowSummary, error) {
+	var g errgroup.Group
+	counts := make([]int64, len(durations))
+	for i, dur := range durations {
+		i, start := i, now.Add(-1*dur)
+		g.Go(func() error { return s.timedActionSum(&counts[i], app, filter, start) })
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	summary := make(models.WindowSummary, len(names))
+	for i, name := range names {
+		summary[name] = counts[i]
+	}
+	return summary, nil
+}
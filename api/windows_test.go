@@ -0,0 +1,61 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+func TestActionWindows(t *testing.T) {
+	_, e := newTestService(t)
+	app := createTestApp(t, e, "max_backfill=720h")
+
+	// Create actions 30 minutes, 3 hours and 2 days ago
+	now := time.Now()
+	for _, seed := range []struct {
+		ago   time.Duration
+		count int
+	}{
+		{30 * time.Minute, 1},
+		{3 * time.Hour, 2},
+		{48 * time.Hour, 4},
+	} {
+		path := fmt.Sprintf("/v1/app/%s/action/signup/create/%d?timestamp=%d",
+			app.ID, seed.count, now.Add(-1*seed.ago).Unix())
+		if code := testRequest(t, e, http.MethodPost, path, app.Token, nil, nil); code != http.StatusOK {
+			t.Fatalf("Expected CreateAction to return 200, got %d", code)
+		}
+	}
+
+	// Every window is counted and keyed as it was passed
+	var summary models.WindowSummary
+	path := fmt.Sprintf("/v1/app/%s/action/signup/count", app.ID)
+	if code := testRequest(t, e, http.MethodGet, path+"?windows=1h,6h,30d", "",
+		nil, &summary); code != http.StatusOK {
+		t.Fatalf("Expected a windowed ActionSummary to return 200, got %d", code)
+	}
+	for window, count := range map[string]int64{"1h": 1, "6h": 3, "30d": 7} {
+		if summary[window] != count {
+			t.Errorf("Expected a count of %d in the %s window, got %d", count, window, summary[window])
+		}
+	}
+
+	// Invalid, too long, too many and combined windows are rejected
+	tooMany := strings.TrimSuffix(strings.Repeat("1h,", maxSummaryWindows+1), ",")
+	for _, query := range []string{
+		"?windows=soon",
+		"?windows=0h",
+		fmt.Sprintf("?windows=%dd", maxWindowDays+1),
+		"?windows=999999999999d",
+		"?windows=" + tooMany,
+		"?windows=1h&compare=true",
+	} {
+		if code := testRequest(t, e, http.MethodGet, path+query, "", nil, nil); code != http.StatusBadRequest {
+			t.Errorf("Expected GET %s to return 400, got %d", path+query, code)
+		}
+	}
+}
@@ -2,6 +2,10 @@ package client
 
 import (
 	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/sdwolfe32/tinystat/models"
 )
@@ -14,15 +18,48 @@ func (c *Client) CreateAction(action string) error {
 
 // CreateActions increments the action passed in our clients actions
 func (c *Client) CreateActions(action string, count int64) error {
+	return c.CreateTaggedActions(action, nil, count)
+}
+
+// CreateTaggedAction increments the action passed with the passed
+// tags (ex: platform:ios) in our clients actions
+func (c *Client) CreateTaggedAction(action string, tags models.Tags) error {
+	return c.CreateTaggedActions(action, tags, 1)
+}
+
+// CreateTaggedActions increments the action passed with the passed
+// tags in our clients actions
+func (c *Client) CreateTaggedActions(action string, tags models.Tags, count int64) error {
+	return c.CreateTaggedActionsAt(action, tags, count, time.Now())
+}
+
+// CreateTaggedActionsAt increments the action passed with the passed
+// tags as having occurred at the passed time (ex: when importing
+// historical counts). Times are kept to the minute, the finest bucket
+// resolution, and must be within the Apps backfill window when sent
+func (c *Client) CreateTaggedActionsAt(action string, tags models.Tags, count int64, at time.Time) error {
 	// Check for missing credentials on client
 	if c.appID == "" || c.token == "" {
 		return ErrMissingCredentials
 	}
 
+	// Validate the action so it isn't rejected once sent
+	if action == "" || len(action) > maxActionLength {
+		return ErrInvalidAction
+	}
+	if count < 1 {
+		return ErrInvalidCount
+	}
+	if err := tags.Validate(); err != nil {
+		return err
+	}
+
 	// Store the actions
 	c.Lock()
 	defer c.Unlock()
-	c.actions[action] = c.actions[action] + count
+	key := actionKey{action: action, tags: tags.String(),
+		minute: at.UTC().Truncate(time.Minute)}
+	c.actions[key] = c.actions[key] + count
 	return nil
 }
 
@@ -40,6 +77,81 @@ func (c *Client) ActionSummary(action string) (*models.ActionSummary, error) {
 	return &summary, c.get(path, &summary)
 }
 
+// ActionCalendarSummary retrieves the summary of actions for the
+// passed action name for the current hour, day, week, month and year
+// in the passed IANA timezone (ex: America/New_York)
+func (c *Client) ActionCalendarSummary(action, tz string) (*models.ActionSummary, error) {
+	// Check for missing credentials on client
+	if c.appID == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded summary
+	var summary models.ActionSummary
+	query := url.Values{"calendar": {"true"}, "tz": {tz}}
+	path := fmt.Sprintf(actionCalendarGetPath, c.appID, action, query.Encode())
+	return &summary, c.get(path, &summary)
+}
+
+// ActionSummaryComparison retrieves the summary of actions for the
+// passed action name with every window compared to the one preceding it
+func (c *Client) ActionSummaryComparison(action string) (*models.ActionSummaryComparison, error) {
+	// Check for missing credentials on client
+	if c.appID == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded comparison
+	var comparison models.ActionSummaryComparison
+	query := url.Values{"compare": {"true"}}
+	path := fmt.Sprintf(actionCalendarGetPath, c.appID, action, query.Encode())
+	return &comparison, c.get(path, &comparison)
+}
+
+// ActionCalendarSummaryComparison retrieves the calendar aligned
+// summary of actions for the passed action name and IANA timezone
+// with every window compared to the same part of the one preceding it
+func (c *Client) ActionCalendarSummaryComparison(action, tz string) (*models.ActionSummaryComparison, error) {
+	// Check for missing credentials on client
+	if c.appID == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded comparison
+	var comparison models.ActionSummaryComparison
+	query := url.Values{"calendar": {"true"}, "tz": {tz}, "compare": {"true"}}
+	path := fmt.Sprintf(actionCalendarGetPath, c.appID, action, query.Encode())
+	return &comparison, c.get(path, &comparison)
+}
+
+// ActionWindows retrieves the count of actions for the passed action
+// name in every passed window, each ending now
+func (c *Client) ActionWindows(action string, windows ...time.Duration) (map[time.Duration]int64, error) {
+	// Check for missing credentials on client
+	if c.appID == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request
+	var summary models.WindowSummary
+	names := make([]string, len(windows))
+	for i, window := range windows {
+		names[i] = window.String()
+	}
+	query := url.Values{"windows": {strings.Join(names, ",")}}
+	path := fmt.Sprintf(actionCalendarGetPath, c.appID, action, query.Encode())
+	if err := c.get(path, &summary); err != nil {
+		return nil, err
+	}
+
+	// Key the decoded counts by their windows and return
+	counts := make(map[time.Duration]int64, len(windows))
+	for i, window := range windows {
+		counts[window] = summary[names[i]]
+	}
+	return counts, nil
+}
+
 // ActionCount retrieves the count of actions for the
 // passed action name and duration
 func (c *Client) ActionCount(action, duration string) (int64, error) {
@@ -53,3 +165,104 @@ func (c *Client) ActionCount(action, duration string) (int64, error) {
 	path := fmt.Sprintf(actionGetPath, c.appID, action, duration)
 	return count, c.get(path, &count)
 }
+
+// ActionRangeCount retrieves the count of actions for the passed
+// action name between from (inclusive) and to (exclusive)
+func (c *Client) ActionRangeCount(action string, from, to time.Time) (int64, error) {
+	// Check for missing credentials on client
+	if c.appID == "" {
+		return 0, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded count
+	var count int64
+	query := url.Values{
+		"from": {from.Format(time.RFC3339)},
+		"to":   {to.Format(time.RFC3339)},
+	}
+	path := fmt.Sprintf(actionRangeGetPath, c.appID, action, query.Encode())
+	return count, c.get(path, &count)
+}
+
+// ActionSeries retrieves the count of actions for the passed
+// action name in every interval (minute, hour, day, week or month)
+// between from and to
+func (c *Client) ActionSeries(action string, from, to time.Time, interval string) ([]models.SeriesPoint, error) {
+	// Check for missing credentials on client
+	if c.appID == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded series
+	var series []models.SeriesPoint
+	query := url.Values{
+		"from":     {from.Format(time.RFC3339)},
+		"to":       {to.Format(time.RFC3339)},
+		"interval": {interval},
+	}
+	path := fmt.Sprintf(actionSeriesGetPath, c.appID, action, query.Encode())
+	return series, c.get(path, &series)
+}
+
+// ListActions retrieves every distinct action name starting with
+// prefix (or all of them if empty) ordered by name, along with its
+// all-time total and when it was first and last seen. At most limit
+// (1-1000) actions are returned after skipping offset
+func (c *Client) ListActions(prefix string, limit, offset int) ([]models.ActionTotal, error) {
+	// Check for missing credentials on client
+	if c.appID == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded totals
+	var totals []models.ActionTotal
+	query := url.Values{
+		"prefix": {prefix},
+		"limit":  {strconv.Itoa(limit)},
+		"offset": {strconv.Itoa(offset)},
+	}
+	path := fmt.Sprintf(actionsGetPath, c.appID, query.Encode())
+	return totals, c.get(path, &totals)
+}
+
+// TopActions retrieves the actions with the highest counts in the
+// passed duration, starting with prefix if it isn't empty. At most
+// limit (1-1000) actions are returned after skipping offset
+func (c *Client) TopActions(duration, prefix string, limit, offset int) ([]models.ActionTotal, error) {
+	// Check for missing credentials on client
+	if c.appID == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded totals
+	var totals []models.ActionTotal
+	query := url.Values{
+		"prefix": {prefix},
+		"limit":  {strconv.Itoa(limit)},
+		"offset": {strconv.Itoa(offset)},
+	}
+	path := fmt.Sprintf(topActionsGetPath, c.appID, duration, query.Encode())
+	return totals, c.get(path, &totals)
+}
+
+// TopActionsRange retrieves the actions with the highest counts
+// between from (inclusive) and to (exclusive). Everything else
+// behaves the same as in TopActions
+func (c *Client) TopActionsRange(from, to time.Time, prefix string, limit, offset int) ([]models.ActionTotal, error) {
+	// Check for missing credentials on client
+	if c.appID == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded totals
+	var totals []models.ActionTotal
+	query := url.Values{
+		"from":   {from.Format(time.RFC3339)},
+		"to":     {to.Format(time.RFC3339)},
+		"prefix": {prefix},
+		"limit":  {strconv.Itoa(limit)},
+		"offset": {strconv.Itoa(offset)},
+	}
+	path := fmt.Sprintf(topActionsRangeGetPath, c.appID, query.Encode())
+	return totals, c.get(path, &totals)
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+// AppOptions contains the optional settings of a new App. Zero values
+// use the server defaults
+type AppOptions struct {
+	StrictAuth    bool          // Require the token on every request
+	Resolution    string        // minute, hour or day
+	RetentionDays int           // Negative keeps actions forever
+	MaxSkew       time.Duration // How far in the future timestamps may be
+	MaxBackfill   time.Duration // How far in the past timestamps may be
+}
+
+// NewAdminClient generates a new Client used to manage Apps with the
+// passed admin token. It doesn't report any actions
+func NewAdminClient(adminToken, baseURL string, version int, timeout time.Duration) *Client {
+	c := newClient(baseURL, version, timeout)
+	c.SetAdminToken(adminToken)
+	return c
+}
+
+// SetAdminToken sets the admin token on the Client
+func (c *Client) SetAdminToken(adminToken string) { c.adminToken = adminToken }
+
+// CreateApp creates a new App with the passed name and options. The
+// returned App contains its token, which can't be retrieved again
+func (c *Client) CreateApp(name string, opts AppOptions) (*models.App, error) {
+	// Check for missing credentials on client
+	if c.adminToken == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded App
+	var app models.App
+	query := url.Values{"strict_auth": {strconv.FormatBool(opts.StrictAuth)}}
+	if opts.Resolution != "" {
+		query.Set("resolution", opts.Resolution)
+	}
+	if opts.RetentionDays != 0 {
+		query.Set("retention_days", strconv.Itoa(opts.RetentionDays))
+	}
+	if opts.MaxSkew != 0 {
+		query.Set("max_skew", opts.MaxSkew.String())
+	}
+	if opts.MaxBackfill != 0 {
+		query.Set("max_backfill", opts.MaxBackfill.String())
+	}
+	path := fmt.Sprintf(appCreatePath, url.PathEscape(name), query.Encode())
+	return &app, c.post(path, nil, &app)
+}
+
+// GetApp retrieves the App with the passed ID, without its token
+func (c *Client) GetApp(appID string) (*models.App, error) {
+	// Check for missing credentials on client
+	if c.adminToken == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded App
+	var app models.App
+	return &app, c.get(fmt.Sprintf(appPath, appID), &app)
+}
+
+// RenameApp changes the name of the App with the passed ID
+func (c *Client) RenameApp(appID, name string) (*models.App, error) {
+	// Check for missing credentials on client
+	if c.adminToken == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded App
+	var app models.App
+	path := fmt.Sprintf(appRenamePath, appID, url.PathEscape(name))
+	return &app, c.post(path, nil, &app)
+}
+
+// SetStrictAuth sets whether every request of the App with the passed
+// ID must be authenticated
+func (c *Client) SetStrictAuth(appID string, strictAuth bool) (*models.App, error) {
+	// Check for missing credentials on client
+	if c.adminToken == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded App
+	var app models.App
+	path := fmt.Sprintf(appStrictAuthPath, appID, strconv.FormatBool(strictAuth))
+	return &app, c.post(path, nil, &app)
+}
+
+// RotateToken replaces the token of the Clients App with a newly
+// generated one and starts using it. The previous token remains valid
+// for the passed grace period so other clients can be updated. A
+// negative grace uses the server default and 0 revokes it immediately
+func (c *Client) RotateToken(grace time.Duration) (*models.TokenRotation, error) {
+	// Check for missing credentials on client
+	if c.appID == "" || c.token == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request
+	var rotation models.TokenRotation
+	query := url.Values{}
+	if grace >= 0 {
+		query.Set("grace", grace.String())
+	}
+	path := fmt.Sprintf(tokenRotatePath, c.appID, query.Encode())
+	if err := c.post(path, nil, &rotation); err != nil {
+		return nil, err
+	}
+
+	// Use the new token for all future requests and return
+	c.Lock()
+	c.SetToken(rotation.Token)
+	c.Unlock()
+	return &rotation, nil
+}
+
+// DeleteApp deletes the App with the passed ID along with all of its
+// stats
+func (c *Client) DeleteApp(appID string) error {
+	// Check for missing credentials on client
+	if c.adminToken == "" {
+		return ErrMissingCredentials
+	}
+
+	// Execute the request
+	return c.do(http.MethodDelete, fmt.Sprintf(appPath, appID), nil, nil)
+}
@@ -7,15 +7,56 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"sync"
 	"time"
+
+	"github.com/sdwolfe32/tinystat/models"
+	"github.com/sdwolfe32/tinystat/sketch"
 )
 
 // baseURL is the baseURL of Tinystat
 const (
-	actionPostPath       = "/app/%s/action/%s/create/%v"
-	actionSummaryGetPath = "/app/%s/action/%s/count"
-	actionGetPath        = "/app/%s/action/%s/count/%s"
+	appCreatePath           = "/app/create/%s?%s"
+	appPath                 = "/app/%s"
+	appRenamePath           = "/app/%s/rename/%s"
+	appStrictAuthPath       = "/app/%s/strict_auth/%s"
+	tokenRotatePath         = "/app/%s/token/rotate?%s"
+	keyCreatePath           = "/app/%s/keys/create/%s?%s"
+	keysPath                = "/app/%s/keys"
+	keyPath                 = "/app/%s/keys/%s"
+	actionsPostPath         = "/app/%s/actions?%s"
+	actionsGetPath          = "/app/%s/actions?%s"
+	topActionsGetPath       = "/app/%s/actions/top/%s?%s"
+	topActionsRangeGetPath  = "/app/%s/actions/top?%s"
+	queryGetPath            = "/app/%s/query/%s?%s"
+	queryRangeGetPath       = "/app/%s/query?%s"
+	actionSummaryGetPath    = "/app/%s/action/%s/count"
+	actionCalendarGetPath   = "/app/%s/action/%s/count?%s"
+	actionGetPath           = "/app/%s/action/%s/count/%s"
+	actionRangeGetPath      = "/app/%s/action/%s/range?%s"
+	actionSeriesGetPath     = "/app/%s/action/%s/series?%s"
+	uniquePostPath          = "/app/%s/action/%s/unique"
+	uniqueGetPath           = "/app/%s/action/%s/unique/%s"
+	uniqueRangeGetPath      = "/app/%s/action/%s/unique?%s"
+	distributionPostPath    = "/app/%s/action/%s/distribution"
+	percentilesGetPath      = "/app/%s/action/%s/percentiles/%s"
+	percentilesRangeGetPath = "/app/%s/action/%s/percentiles?%s"
+	gaugePostPath           = "/app/%s/gauge/%s"
+	gaugeGetPath            = "/app/%s/gauge/%s/stats/%s"
+	gaugeRangeGetPath       = "/app/%s/gauge/%s/range?%s"
+)
+
+const (
+	// maxBatchActions is the maximum number of actions the Tinystat
+	// API accepts in a single request
+	maxBatchActions = 1000
+	// maxActionLength is the maximum length of an action name the
+	// Tinystat API accepts
+	maxActionLength = 100
+	// maxUniqueIDs is the maximum number of identifiers the Tinystat
+	// API accepts in a single request
+	maxUniqueIDs = 10000
 )
 
 var (
@@ -25,6 +66,15 @@ var (
 	// ErrMissingCredentials is thrown when we fail to find
 	// an appID or token on the DefaultClient
 	ErrMissingCredentials = errors.New("Tinystat credentials are missing")
+	// ErrBadRequest is thrown when the Tinystat API rejects a
+	// request as invalid, so retrying it won't succeed
+	ErrBadRequest = errors.New("Request rejected as invalid")
+	// ErrInvalidAction is thrown when an action name is empty or
+	// too long to be accepted by the Tinystat API
+	ErrInvalidAction = errors.New("Action names must be 1-100 characters")
+	// ErrInvalidCount is thrown when actions are created with a
+	// count below 1
+	ErrInvalidCount = errors.New("Counts must be at least 1")
 )
 
 // Client contains all dependencies needed to communicate
@@ -32,11 +82,23 @@ var (
 type Client struct {
 	sync.RWMutex
 	client  *http.Client
-	actions map[string]int64 // action -> count
-	baseURL string           // The base url of the Tinystat server
-	version int              // Will add /v#/ to the path
+	actions map[actionKey]int64            // action, tags & minute -> count
+	uniques map[string]map[string]struct{} // action -> identifiers
+	gauges  map[string]*models.Gauge       // gauge -> samples
+	dists   map[string]*sketch.Histogram   // action -> observed values
+	baseURL string                         // The base url of the Tinystat server
+	version int                            // Will add /v#/ to the path
 	appID   string
 	token   string
+
+	adminToken string // Only required to manage Apps
+}
+
+// actionKey identifies a buffered action by its name, canonical
+// tags and the minute it occurred in
+type actionKey struct {
+	action, tags string
+	minute       time.Time
 }
 
 // NewClient generates a new standard Client using the passed
@@ -57,7 +119,10 @@ func NewClient(appID, token string, baseURL string, version int, timeout, sendFr
 func newClient(baseURL string, version int, timeout time.Duration) *Client {
 	return &Client{
 		client:  &http.Client{Timeout: timeout},
-		actions: make(map[string]int64),
+		actions: make(map[actionKey]int64),
+		uniques: make(map[string]map[string]struct{}),
+		gauges:  make(map[string]*models.Gauge),
+		dists:   make(map[string]*sketch.Histogram),
 		baseURL: baseURL,
 		version: version,
 	}
@@ -80,23 +145,165 @@ func (c *Client) sendWorker(sendFreq time.Duration) {
 	// Begin infinite send loop
 	for {
 		time.Sleep(sendFreq)
-		c.Lock()
-		// Create an action for every count
-		for action, count := range c.actions {
-			// Ignore actions with a count of 0
-			if c.actions[action] == 0 {
-				continue
+		c.flush()
+	}
+}
+
+// flush sends every buffered metric to the Tinystat API. The buffers
+// are swapped out under the lock and sent once it's released so
+// recording metrics never waits on the API. Anything that isn't
+// reported is merged back to be sent on the next flush
+func (c *Client) flush() {
+	c.Lock()
+	actions, uniques, gauges, dists := c.actions, c.uniques, c.gauges, c.dists
+	c.actions = make(map[actionKey]int64)
+	c.uniques = make(map[string]map[string]struct{})
+	c.gauges = make(map[string]*models.Gauge)
+	c.dists = make(map[string]*sketch.Histogram)
+	c.Unlock()
+
+	// Send the buffers, each removing whatever it reports
+	c.sendActions(actions)
+	c.sendUniques(uniques)
+	c.sendGauges(gauges)
+	c.sendDistributions(dists)
+
+	// Merge back everything that remains with what was recorded
+	// during the flush
+	c.Lock()
+	defer c.Unlock()
+	for key, count := range actions {
+		c.actions[key] = c.actions[key] + count
+	}
+	for action, ids := range uniques {
+		if c.uniques[action] == nil {
+			c.uniques[action] = ids
+			continue
+		}
+		for id := range ids {
+			c.uniques[action][id] = struct{}{}
+		}
+	}
+	for gauge, samples := range gauges {
+		if c.gauges[gauge] == nil {
+			c.gauges[gauge] = samples
+			continue
+		}
+		c.gauges[gauge].Merge(*samples)
+	}
+	for action, hist := range dists {
+		if c.dists[action] == nil {
+			c.dists[action] = hist
+			continue
+		}
+		c.dists[action].Merge(hist)
+	}
+}
+
+// sendActions sends the counts of up to maxBatchActions of the passed
+// actions to the Tinystat API in a single request, removing them if
+// successfully reported. The API applies a batch all-or-nothing, so
+// if it rejects any entry (ex: buffered for longer than the Apps
+// backfill window) only the rejected entries are removed and the rest
+// are sent again on the next flush along with any remaining actions
+func (c *Client) sendActions(actions map[actionKey]int64) {
+	var keys []actionKey
+	var entries []models.ActionEntry
+	for key, count := range actions {
+		// Ignore actions with a count of 0
+		if count == 0 {
+			continue
+		}
+		keys = append(keys, key)
+		entries = append(entries, models.ActionEntry{Action: key.action,
+			Count: count, Tags: key.tags, Timestamp: key.minute})
+		if len(entries) == maxBatchActions {
+			break
+		}
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	// Perform the request. The send time lets the API correct for
+	// our clock
+	query := url.Values{"sent_at": {time.Now().UTC().Format(time.RFC3339Nano)}}
+	path := fmt.Sprintf(actionsPostPath, c.appID, query.Encode())
+	res, err := c.send(http.MethodPost, path, entries)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	// Remove only the rejected actions if the batch had invalid
+	// entries, or every action if it was accepted or rejected as a
+	// whole. Any other failure is retried
+	if res.StatusCode == http.StatusBadRequest {
+		var batchErr models.ActionBatchError
+		if json.NewDecoder(res.Body).Decode(&batchErr) == nil && len(batchErr.Rejected) > 0 {
+			for _, rejected := range batchErr.Rejected {
+				if rejected.Index >= 0 && rejected.Index < len(keys) {
+					delete(actions, keys[rejected.Index])
+				}
 			}
+			return
+		}
+	} else if res.StatusCode != http.StatusOK {
+		return
+	}
+	for _, key := range keys {
+		delete(actions, key)
+	}
+}
 
-			// Perform the request
-			if err := c.post(fmt.Sprintf(actionPostPath, c.appID, action, count), nil, nil); err != nil {
-				continue
+// sendUniques sends up to maxUniqueIDs of the passed identifiers of
+// every action to the Tinystat API, removing those successfully
+// reported. Only a single request is sent per action as requests are
+// rate limited, so any remaining identifiers are sent on the next
+// flush
+func (c *Client) sendUniques(uniques map[string]map[string]struct{}) {
+	for action, ids := range uniques {
+		var batch []string
+		for id := range ids {
+			batch = append(batch, id)
+			if len(batch) == maxUniqueIDs {
+				break
 			}
+		}
+		in := models.UniqueIDs{IDs: batch}
+		if err := c.post(fmt.Sprintf(uniquePostPath, c.appID, action), in, nil); err != nil {
+			continue
+		}
+		for _, id := range batch {
+			delete(ids, id)
+		}
+
+		// Remove the action once all of its identifiers are reported
+		if len(ids) == 0 {
+			delete(uniques, action)
+		}
+	}
+}
+
+// sendGauges sends the passed samples of every gauge to the Tinystat
+// API, removing those successfully reported
+func (c *Client) sendGauges(gauges map[string]*models.Gauge) {
+	for gauge, samples := range gauges {
+		if err := c.post(fmt.Sprintf(gaugePostPath, c.appID, gauge), samples, nil); err != nil {
+			continue
+		}
+		delete(gauges, gauge)
+	}
+}
 
-			// Zero out the actions if it was successfully reported
-			c.actions[action] = 0
+// sendDistributions sends the passed histogram of every action to the
+// Tinystat API, removing those successfully reported
+func (c *Client) sendDistributions(dists map[string]*sketch.Histogram) {
+	for action, hist := range dists {
+		if err := c.post(fmt.Sprintf(distributionPostPath, c.appID, action), hist, nil); err != nil {
+			continue
 		}
-		c.Unlock()
+		delete(dists, action)
 	}
 }
 
@@ -115,12 +322,38 @@ func (c *Client) get(path string, out interface{}) error {
 // do executes the passed request and decodes the response into
 // the out interface
 func (c *Client) do(method, path string, in, out interface{}) error {
+	// Perform the request
+	res, err := c.send(method, path, in)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// Check the status code of the response
+	if res.StatusCode == http.StatusBadRequest {
+		return ErrBadRequest
+	}
+	if res.StatusCode != http.StatusOK {
+		return ErrNonOKResponse
+	}
+
+	// Decode the successful response if an out
+	// interface is passed
+	if out != nil {
+		return json.NewDecoder(res.Body).Decode(out)
+	}
+	return nil
+}
+
+// send performs the passed request with the in interface as its body
+// and returns the response, which must be closed by the caller
+func (c *Client) send(method, path string, in interface{}) (*http.Response, error) {
 	// Marshal a request body if one exists
 	var body io.Reader
 	if in != nil {
 		jsonBytes, err := json.Marshal(in)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		body = bytes.NewBuffer(jsonBytes)
 	}
@@ -132,28 +365,19 @@ func (c *Client) do(method, path string, in, out interface{}) error {
 	// if found on the client
 	req, err := http.NewRequest(method, url, body)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if c.token != "" {
-		req.Header.Add("TOKEN", c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
 	}
-
-	// Perform the request
-	res, err := c.client.Do(req)
-	if err != nil {
-		return err
+	c.RLock()
+	token := c.token
+	c.RUnlock()
+	if token != "" {
+		req.Header.Add("TOKEN", token)
 	}
-	defer res.Body.Close()
-
-	// Check the status code of the response
-	if res.StatusCode != http.StatusOK {
-		return ErrNonOKResponse
-	}
-
-	// Decode the successful response if an out
-	// interface is passed
-	if out != nil {
-		return json.NewDecoder(res.Body).Decode(out)
+	if c.adminToken != "" {
+		req.Header.Add("ADMIN-TOKEN", c.adminToken)
 	}
-	return nil
+	return c.client.Do(req)
 }
@@ -17,12 +17,149 @@ func CreateAction(action string) error {
 	return DefaultClient.CreateAction(action)
 }
 
+// CreateActions creates count new actions using the DefaultClient
+func CreateActions(action string, count int64) error {
+	return DefaultClient.CreateActions(action, count)
+}
+
+// CreateTaggedAction creates a new action with tags using the
+// DefaultClient
+func CreateTaggedAction(action string, tags models.Tags) error {
+	return DefaultClient.CreateTaggedAction(action, tags)
+}
+
 // ActionSummary retrieves an action summary using the DefaultClient
 func ActionSummary(action string) (*models.ActionSummary, error) {
 	return DefaultClient.ActionSummary(action)
 }
 
+// ActionCalendarSummary retrieves a calendar aligned action summary
+// using the DefaultClient
+func ActionCalendarSummary(action, tz string) (*models.ActionSummary, error) {
+	return DefaultClient.ActionCalendarSummary(action, tz)
+}
+
+// ActionWindows retrieves the count of an action in every passed
+// window using the DefaultClient
+func ActionWindows(action string, windows ...time.Duration) (map[time.Duration]int64, error) {
+	return DefaultClient.ActionWindows(action, windows...)
+}
+
+// ActionSummaryComparison retrieves an action summary compared to the
+// preceding windows using the DefaultClient
+func ActionSummaryComparison(action string) (*models.ActionSummaryComparison, error) {
+	return DefaultClient.ActionSummaryComparison(action)
+}
+
+// ActionCalendarSummaryComparison retrieves a calendar aligned action
+// summary compared to the preceding windows using the DefaultClient
+func ActionCalendarSummaryComparison(action, tz string) (*models.ActionSummaryComparison, error) {
+	return DefaultClient.ActionCalendarSummaryComparison(action, tz)
+}
+
 // ActionCount retrieves action stats using the DefaultClient
 func ActionCount(action, duration string) (int64, error) {
 	return DefaultClient.ActionCount(action, duration)
 }
+
+// ActionRangeCount retrieves an action count between two times
+// using the DefaultClient
+func ActionRangeCount(action string, from, to time.Time) (int64, error) {
+	return DefaultClient.ActionRangeCount(action, from, to)
+}
+
+// ActionSeries retrieves an action time-series using the DefaultClient
+func ActionSeries(action string, from, to time.Time, interval string) ([]models.SeriesPoint, error) {
+	return DefaultClient.ActionSeries(action, from, to, interval)
+}
+
+// CreateUnique records a unique identifier for an action using the
+// DefaultClient
+func CreateUnique(action, id string) error {
+	return DefaultClient.CreateUnique(action, id)
+}
+
+// UniqueCount retrieves an approximate unique count using the
+// DefaultClient
+func UniqueCount(action, duration string) (*models.UniqueCount, error) {
+	return DefaultClient.UniqueCount(action, duration)
+}
+
+// UniqueRangeCount retrieves an approximate unique count between two
+// times using the DefaultClient
+func UniqueRangeCount(action string, from, to time.Time) (*models.UniqueCount, error) {
+	return DefaultClient.UniqueRangeCount(action, from, to)
+}
+
+// SetGauge records the current value of a gauge using the
+// DefaultClient
+func SetGauge(gauge string, value float64) error {
+	return DefaultClient.SetGauge(gauge, value)
+}
+
+// GaugeStats retrieves gauge stats using the DefaultClient
+func GaugeStats(gauge, duration string) (*models.GaugeStats, error) {
+	return DefaultClient.GaugeStats(gauge, duration)
+}
+
+// GaugeRangeStats retrieves gauge stats between two times using the
+// DefaultClient
+func GaugeRangeStats(gauge string, from, to time.Time) (*models.GaugeStats, error) {
+	return DefaultClient.GaugeRangeStats(gauge, from, to)
+}
+
+// Time records how long an action took using the DefaultClient
+func Time(action string, duration time.Duration) error {
+	return DefaultClient.Time(action, duration)
+}
+
+// Observe records a single value of an action using the
+// DefaultClient
+func Observe(action string, value float64) error {
+	return DefaultClient.Observe(action, value)
+}
+
+// ActionPercentiles retrieves action percentiles using the
+// DefaultClient
+func ActionPercentiles(action, duration string) (*models.Percentiles, error) {
+	return DefaultClient.ActionPercentiles(action, duration)
+}
+
+// ActionRangePercentiles retrieves action percentiles between two
+// times using the DefaultClient
+func ActionRangePercentiles(action string, from, to time.Time) (*models.Percentiles, error) {
+	return DefaultClient.ActionRangePercentiles(action, from, to)
+}
+
+// ListActions lists the actions of the app using the DefaultClient
+func ListActions(prefix string, limit, offset int) ([]models.ActionTotal, error) {
+	return DefaultClient.ListActions(prefix, limit, offset)
+}
+
+// TopActions ranks the actions of the app using the DefaultClient
+func TopActions(duration, prefix string, limit, offset int) ([]models.ActionTotal, error) {
+	return DefaultClient.TopActions(duration, prefix, limit, offset)
+}
+
+// TopActionsRange ranks the actions of the app between two times
+// using the DefaultClient
+func TopActionsRange(from, to time.Time, prefix string, limit, offset int) ([]models.ActionTotal, error) {
+	return DefaultClient.TopActionsRange(from, to, prefix, limit, offset)
+}
+
+// QueryActions retrieves the counts and ratios of several actions
+// using the DefaultClient
+func QueryActions(duration string, funnel bool, actions ...string) (*models.ActionQuery, error) {
+	return DefaultClient.QueryActions(duration, funnel, actions...)
+}
+
+// QueryActionsRange retrieves the counts and ratios of several actions
+// between two times using the DefaultClient
+func QueryActionsRange(from, to time.Time, funnel bool, actions ...string) (*models.ActionQuery, error) {
+	return DefaultClient.QueryActionsRange(from, to, funnel, actions...)
+}
+
+// RotateToken rotates the token of the App using the DefaultClient
+func RotateToken(grace time.Duration) (*models.TokenRotation, error) {
+	return DefaultClient.RotateToken(grace)
+}
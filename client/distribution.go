@@ -0,0 +1,68 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/sdwolfe32/tinystat/models"
+	"github.com/sdwolfe32/tinystat/sketch"
+)
+
+// Time records how long the passed action took in milliseconds
+// (ex: defer c.Time("request", time.Since(start)))
+func (c *Client) Time(action string, duration time.Duration) error {
+	return c.Observe(action, float64(duration)/float64(time.Millisecond))
+}
+
+// Observe records a single value of the passed action in our
+// clients histograms. All values observed between sends are reported
+// together as a single histogram
+func (c *Client) Observe(action string, value float64) error {
+	// Check for missing credentials on client
+	if c.appID == "" || c.token == "" {
+		return ErrMissingCredentials
+	}
+
+	// Store the value
+	c.Lock()
+	defer c.Unlock()
+	if c.dists[action] == nil {
+		c.dists[action] = sketch.NewHistogram()
+	}
+	c.dists[action].Add(value)
+	return nil
+}
+
+// ActionPercentiles retrieves the p50, p90, p99 and max of all values
+// observed for the passed action name in the passed duration
+func (c *Client) ActionPercentiles(action, duration string) (*models.Percentiles, error) {
+	// Check for missing credentials on client
+	if c.appID == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded percentiles
+	var percentiles models.Percentiles
+	path := fmt.Sprintf(percentilesGetPath, c.appID, action, duration)
+	return &percentiles, c.get(path, &percentiles)
+}
+
+// ActionRangePercentiles retrieves the p50, p90, p99 and max of all
+// values observed for the passed action name between from
+// (inclusive) and to (exclusive)
+func (c *Client) ActionRangePercentiles(action string, from, to time.Time) (*models.Percentiles, error) {
+	// Check for missing credentials on client
+	if c.appID == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded percentiles
+	var percentiles models.Percentiles
+	query := url.Values{
+		"from": {from.Format(time.RFC3339)},
+		"to":   {to.Format(time.RFC3339)},
+	}
+	path := fmt.Sprintf(percentilesRangeGetPath, c.appID, action, query.Encode())
+	return &percentiles, c.get(path, &percentiles)
+}
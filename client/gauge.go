@@ -0,0 +1,61 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+// SetGauge records the current value of a gauge (ex: queue depth)
+// in our clients gauges. All values set between sends are reported
+// together with their last, min, max and sum
+func (c *Client) SetGauge(gauge string, value float64) error {
+	// Check for missing credentials on client
+	if c.appID == "" || c.token == "" {
+		return ErrMissingCredentials
+	}
+
+	// Store the value
+	c.Lock()
+	defer c.Unlock()
+	if c.gauges[gauge] == nil {
+		c.gauges[gauge] = &models.Gauge{}
+	}
+	c.gauges[gauge].Set(value, time.Now())
+	return nil
+}
+
+// GaugeStats retrieves the last, min, max, average and sum of all
+// values of the passed gauge in the passed duration
+func (c *Client) GaugeStats(gauge, duration string) (*models.GaugeStats, error) {
+	// Check for missing credentials on client
+	if c.appID == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded stats
+	var stats models.GaugeStats
+	path := fmt.Sprintf(gaugeGetPath, c.appID, gauge, duration)
+	return &stats, c.get(path, &stats)
+}
+
+// GaugeRangeStats retrieves the last, min, max, average and sum of
+// all values of the passed gauge between from (inclusive) and to
+// (exclusive)
+func (c *Client) GaugeRangeStats(gauge string, from, to time.Time) (*models.GaugeStats, error) {
+	// Check for missing credentials on client
+	if c.appID == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded stats
+	var stats models.GaugeStats
+	query := url.Values{
+		"from": {from.Format(time.RFC3339)},
+		"to":   {to.Format(time.RFC3339)},
+	}
+	path := fmt.Sprintf(gaugeRangeGetPath, c.appID, gauge, query.Encode())
+	return &stats, c.get(path, &stats)
+}
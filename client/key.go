@@ -0,0 +1,54 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+// CreateKey creates a new Key for the Clients App granted the passed
+// scopes (ex: models.ScopeIngest). The returned Key contains its
+// token, which can't be retrieved again. Requires the Apps token or a
+// Key granted the admin scope
+func (c *Client) CreateKey(name string, scopes ...string) (*models.Key, error) {
+	// Check for missing credentials on client
+	if c.appID == "" || c.token == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded Key
+	var key models.Key
+	query := url.Values{"scopes": {strings.Join(scopes, ",")}}
+	path := fmt.Sprintf(keyCreatePath, c.appID, url.PathEscape(name), query.Encode())
+	return &key, c.post(path, nil, &key)
+}
+
+// ListKeys retrieves every Key of the Clients App, including revoked
+// Keys, without their tokens
+func (c *Client) ListKeys() ([]models.Key, error) {
+	// Check for missing credentials on client
+	if c.appID == "" || c.token == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded Keys
+	var keys []models.Key
+	return keys, c.get(fmt.Sprintf(keysPath, c.appID), &keys)
+}
+
+// RevokeKey permanently revokes the Key of the Clients App with the
+// passed ID
+func (c *Client) RevokeKey(keyID string) (*models.Key, error) {
+	// Check for missing credentials on client
+	if c.appID == "" || c.token == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded Key
+	var key models.Key
+	path := fmt.Sprintf(keyPath, c.appID, keyID)
+	return &key, c.do(http.MethodDelete, path, nil, &key)
+}
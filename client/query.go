@@ -0,0 +1,52 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+// QueryActions retrieves the counts of the passed actions in the
+// passed duration along with the ratios derived from them. If funnel
+// is true the actions are treated as ordered steps and the conversion
+// between every step is included
+func (c *Client) QueryActions(duration string, funnel bool, actions ...string) (*models.ActionQuery, error) {
+	// Check for missing credentials on client
+	if c.appID == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded query
+	var query models.ActionQuery
+	values := url.Values{
+		"actions": {strings.Join(actions, ",")},
+		"funnel":  {strconv.FormatBool(funnel)},
+	}
+	path := fmt.Sprintf(queryGetPath, c.appID, duration, values.Encode())
+	return &query, c.get(path, &query)
+}
+
+// QueryActionsRange retrieves the counts of the passed actions between
+// from (inclusive) and to (exclusive). Everything else behaves the
+// same as in QueryActions
+func (c *Client) QueryActionsRange(from, to time.Time, funnel bool, actions ...string) (*models.ActionQuery, error) {
+	// Check for missing credentials on client
+	if c.appID == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded query
+	var query models.ActionQuery
+	values := url.Values{
+		"from":    {from.Format(time.RFC3339)},
+		"to":      {to.Format(time.RFC3339)},
+		"actions": {strings.Join(actions, ",")},
+		"funnel":  {strconv.FormatBool(funnel)},
+	}
+	path := fmt.Sprintf(queryRangeGetPath, c.appID, values.Encode())
+	return &query, c.get(path, &query)
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/sdwolfe32/tinystat/models"
+)
+
+// CreateUnique records an identifier (ex: a user or session ID)
+// as having performed the passed action. It will later on submit all
+// identifiers to the Tinystat API to be counted uniquely
+func (c *Client) CreateUnique(action, id string) error {
+	// Check for missing credentials on client
+	if c.appID == "" || c.token == "" {
+		return ErrMissingCredentials
+	}
+
+	// Store the identifier
+	c.Lock()
+	defer c.Unlock()
+	if c.uniques[action] == nil {
+		c.uniques[action] = make(map[string]struct{})
+	}
+	c.uniques[action][id] = struct{}{}
+	return nil
+}
+
+// UniqueCount retrieves the approximate number of distinct
+// identifiers for the passed action name and duration
+func (c *Client) UniqueCount(action, duration string) (*models.UniqueCount, error) {
+	// Check for missing credentials on client
+	if c.appID == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded count
+	var count models.UniqueCount
+	path := fmt.Sprintf(uniqueGetPath, c.appID, action, duration)
+	return &count, c.get(path, &count)
+}
+
+// UniqueRangeCount retrieves the approximate number of distinct
+// identifiers for the passed action name between from (inclusive)
+// and to (exclusive)
+func (c *Client) UniqueRangeCount(action string, from, to time.Time) (*models.UniqueCount, error) {
+	// Check for missing credentials on client
+	if c.appID == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	// Execute the request and return the decoded count
+	var count models.UniqueCount
+	query := url.Values{
+		"from": {from.Format(time.RFC3339)},
+		"to":   {to.Format(time.RFC3339)},
+	}
+	path := fmt.Sprintf(uniqueRangeGetPath, c.appID, action, query.Encode())
+	return &count, c.get(path, &count)
+}
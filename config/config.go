@@ -4,6 +4,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var (
@@ -11,12 +12,45 @@ var (
 	Port = getEnv("PORT", "8080")
 	// Env is the environment (development, production)
 	Env = strings.ToLower(getEnv("ENVIRONMENT", "development"))
+	// DBDriver is the storage backend to use (mysql, sqlite, postgres, memory)
+	DBDriver = strings.ToLower(getEnv("DB_DRIVER", "mysql"))
 	// MysqlURL is the URL used to access the MySQL database
 	MysqlURL = getEnv("MYSQL_URL", "")
+	// PostgresURL is the URL used to access the PostgreSQL database
+	PostgresURL = getEnv("POSTGRES_URL", "")
+	// SqlitePath is the path of the SQLite database file
+	SqlitePath = getEnv("SQLITE_PATH", "tinystat.db")
+	// RollupDailyAge is the age after which Action buckets are rolled
+	// up into daily buckets (0 disables)
+	RollupDailyAge, _ = time.ParseDuration(getEnv("ROLLUP_DAILY_AGE", "0"))
+	// RollupMonthlyAge is the age after which Action buckets are rolled
+	// up into monthly buckets (0 disables)
+	RollupMonthlyAge, _ = time.ParseDuration(getEnv("ROLLUP_MONTHLY_AGE", "0"))
+	// RollupFrequency is how often the rollup worker runs
+	RollupFrequency, _ = time.ParseDuration(getEnv("ROLLUP_FREQUENCY", "1h"))
+	// RetentionDays is the default number of days Actions are kept for
+	// by Apps without a retention period of their own (0 keeps forever)
+	RetentionDays, _ = strconv.Atoi(getEnv("RETENTION_DAYS", "0"))
+	// PurgeBatchSize is the maximum number of Actions deleted per query
+	PurgeBatchSize, _ = strconv.Atoi(getEnv("PURGE_BATCH_SIZE", "1000"))
+	// PurgeFrequency is how often the purge worker runs
+	PurgeFrequency, _ = time.ParseDuration(getEnv("PURGE_FREQUENCY", "1h"))
+	// MaxClockSkew is how far in the future submitted event
+	// timestamps may be
+	MaxClockSkew, _ = time.ParseDuration(getEnv("MAX_CLOCK_SKEW", "5m"))
+	// MaxBackfill is how far in the past submitted event timestamps
+	// may be
+	MaxBackfill, _ = time.ParseDuration(getEnv("MAX_BACKFILL", "24h"))
 	// ServeWeb defines if the web static site should be served
 	ServeWeb, _ = strconv.ParseBool(getEnv("SERVE_WEB", "false"))
 	// MaxAppsPerIP is the number of Apps each IP is allowed to have
 	MaxAppsPerIP, _ = strconv.Atoi(getEnv("MAX_APPS_PER_IP", "5"))
+	// AdminToken is the token required to manage Apps (empty disables
+	// app management)
+	AdminToken = getEnv("ADMIN_TOKEN", "")
+	// TokenGracePeriod is how long an Apps previous token remains
+	// valid after rotating it, unless another period is requested
+	TokenGracePeriod, _ = time.ParseDuration(getEnv("TOKEN_GRACE_PERIOD", "24h"))
 	// TinystatAppID is the App ID used with Tinystat
 	TinystatAppID = getEnv("TINYSTAT_APP_ID", "")
 	// TinystatToken is the Token used to authenticate Tinystat requests
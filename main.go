@@ -1,13 +1,12 @@
 package main
 
 import (
+	"fmt"
 	"math/rand"
 	"strings"
 	"time"
 
 	_ "github.com/heroku/x/hmetrics/onload"
-	"github.com/labstack/echo"
-	"github.com/labstack/echo/middleware"
 	"github.com/sdwolfe32/tinystat/api"
 	"github.com/sdwolfe32/tinystat/config"
 	"github.com/sirupsen/logrus"
@@ -30,24 +29,31 @@ func main() {
 
 	// Create the tinystat service
 	l.Info("Generating all Tinystat dependencies")
-	s, err := api.NewService(logger, config.TinystatAppID, config.MysqlURL, config.MaxAppsPerIP, time.Hour*24)
+	l.WithField("driver", config.DBDriver).Info("Connecting to storage backend")
+	store, err := newStore(config.DBDriver)
+	if err != nil {
+		l.WithError(err).Fatalln("Failed to connect to storage backend")
+	}
+	s, err := api.NewService(logger, config.TinystatAppID, store, config.MaxAppsPerIP, time.Hour*24)
 	if err != nil {
 		l.WithError(err).Fatalln("Failed to generate Tinystat service")
 	}
 	defer s.Close()
+	s.SetTimestampWindow(config.MaxClockSkew, config.MaxBackfill)
+	s.SetAdminToken(config.AdminToken)
+	s.SetTokenGracePeriod(config.TokenGracePeriod)
+
+	// Begin compacting old Action buckets
+	l.Info("Starting Action rollup worker")
+	s.StartRollup(config.RollupDailyAge, config.RollupMonthlyAge, config.RollupFrequency)
 
-	// Generate the router
-	l.Info("Generating router and middleware")
-	e := echo.New()
-	e.Use(middleware.Recover())
+	// Begin purging Action buckets past their retention period
+	l.Info("Starting Action purge worker")
+	s.StartPurge(config.RetentionDays, config.PurgeBatchSize, config.PurgeFrequency)
 
-	// Bind all handlers to the router
-	l.Info("Binding API endpoints to the router")
-	// e.POST("/v1/app/create/:name", s.CreateApp, s.RateLimit)
-	e.POST("/v1/app/:app_id/action/:action/create/:count", s.CreateAction, s.RateLimit, s.TokenAuth)
-	e.GET("/v1/app/:app_id/action/:action/count", s.ActionSummary, s.TokenAuth)
-	e.GET("/v1/app/:app_id/action/:action/count/:duration", s.ActionCount, s.TokenAuth)
-	e.GET("/v1/stats", s.Stats)
+	// Generate the router and bind all handlers to it
+	l.Info("Generating router and binding API endpoints")
+	e := s.Router()
 
 	// Host static demo pages if configured to do so
 	// if config.ServeWeb {
@@ -60,3 +66,20 @@ func main() {
 	l.Info("Listening for requests")
 	e.Logger.Fatal(e.Start(":" + config.Port))
 }
+
+// newStore generates the Store for the passed driver using
+// the connection settings found in the config
+func newStore(driver string) (api.Store, error) {
+	switch driver {
+	case "mysql":
+		return api.NewMySQLStore(config.MysqlURL)
+	case "postgres", "postgresql":
+		return api.NewPostgresStore(config.PostgresURL)
+	case "sqlite", "sqlite3":
+		return api.NewSQLiteStore(config.SqlitePath)
+	case "memory":
+		return api.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("Unknown DB driver %q", driver)
+	}
+}
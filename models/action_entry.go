@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// ActionEntry is a single count of an action submitted in a batch.
+// Tags are formatted as key:value,key:value and a zero Timestamp is
+// replaced with the time the batch is received
+type ActionEntry struct {
+	Action    string    `json:"action"`
+	Count     int64     `json:"count"`
+	Tags      string    `json:"tags,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ActionBatchError is returned with a 400 when a batch of
+// ActionEntries contains invalid entries, in which case no entry of
+// the batch is applied
+type ActionBatchError struct {
+	Message  string          `json:"message"`
+	Rejected []RejectedEntry `json:"rejected"`
+}
+
+// RejectedEntry is a single invalid ActionEntry, identified by its
+// index in the batch
+type RejectedEntry struct {
+	Index   int    `json:"index"`
+	Message string `json:"message"` // Why the entry was rejected
+}
@@ -8,3 +8,37 @@ type ActionSummary struct {
 	Month int64 `json:"month"`
 	Year  int64 `json:"year"`
 }
+
+// ActionSummaryComparison contains a summary of actions over several
+// passed intervals compared to the interval preceding each of them
+type ActionSummaryComparison struct {
+	Hour  Comparison `json:"hour"`
+	Day   Comparison `json:"day"`
+	Week  Comparison `json:"week"`
+	Month Comparison `json:"month"`
+	Year  Comparison `json:"year"`
+}
+
+// Comparison contains the count of actions in an interval and in the
+// interval preceding it
+type Comparison struct {
+	Current       int64    `json:"current"`
+	Previous      int64    `json:"previous"`
+	Change        int64    `json:"change"`
+	PercentChange *float64 `json:"percentChange"` // nil if Previous is 0
+}
+
+// NewComparison compares the current count of an interval to the
+// count of the interval preceding it
+func NewComparison(current, previous int64) Comparison {
+	c := Comparison{Current: current, Previous: previous, Change: current - previous}
+	if previous != 0 {
+		percent := float64(c.Change) / float64(previous) * 100
+		c.PercentChange = &percent
+	}
+	return c
+}
+
+// WindowSummary contains the count of actions in every requested
+// window keyed by the window as it was requested
+type WindowSummary map[string]int64
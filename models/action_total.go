@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// ActionTotal is the all-time total of a single action along with
+// the start of the first and last buckets it was seen in
+type ActionTotal struct {
+	Action    string    `json:"action"`
+	Total     int64     `json:"total"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
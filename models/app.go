@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// App is an application that Tinystat counts actions for. Token is
+// only returned when the App is created
+type App struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Token         string    `json:"token,omitempty"`
+	StrictAuth    bool      `json:"strictAuth"`
+	IP            string    `json:"ip"`
+	Resolution    string    `json:"resolution"`
+	RetentionDays int       `json:"retentionDays"`
+	MaxSkew       int       `json:"maxSkew"`     // Seconds
+	MaxBackfill   int       `json:"maxBackfill"` // Seconds
+	CreatedAt     time.Time `json:"createdAt"`
+
+	PreviousTokenExpiresAt *time.Time `json:"previousTokenExpiresAt,omitempty"` // nil unless the token was rotated
+}
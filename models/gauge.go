@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// Gauge contains the samples of a value that goes up and down
+// (ex: queue depth) aggregated over some period of time
+type Gauge struct {
+	Last    float64   `json:"last"`
+	Min     float64   `json:"min"`
+	Max     float64   `json:"max"`
+	Sum     float64   `json:"sum"`
+	Samples int64     `json:"samples"`
+	LastAt  time.Time `json:"lastAt"` // When Last was sampled
+}
+
+// GaugeStats is a Gauge aggregated over a range of time along with
+// the average of all of its samples
+type GaugeStats struct {
+	Gauge
+	Avg float64 `json:"avg"`
+}
+
+// Set records a single sample of the Gauge taken at the passed time
+func (g *Gauge) Set(value float64, at time.Time) {
+	g.Merge(Gauge{Last: value, Min: value, Max: value,
+		Sum: value, Samples: 1, LastAt: at})
+}
+
+// Merge combines the samples of other into the Gauge, keeping the
+// most recent Last value
+func (g *Gauge) Merge(other Gauge) {
+	if other.Samples == 0 {
+		return
+	}
+	if g.Samples == 0 {
+		*g = other
+		return
+	}
+	if other.Min < g.Min {
+		g.Min = other.Min
+	}
+	if other.Max > g.Max {
+		g.Max = other.Max
+	}
+	if !other.LastAt.Before(g.LastAt) {
+		g.Last = other.Last
+		g.LastAt = other.LastAt
+	}
+	g.Sum += other.Sum
+	g.Samples += other.Samples
+}
+
+// Stats returns the Gauge along with the average of its samples
+func (g Gauge) Stats() GaugeStats {
+	stats := GaugeStats{Gauge: g}
+	if g.Samples > 0 {
+		stats.Avg = g.Sum / float64(g.Samples)
+	}
+	return stats
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+const (
+	// ScopeIngest allows a key to report actions, uniques, gauges and
+	// distributions
+	ScopeIngest = "ingest"
+	// ScopeRead allows a key to retrieve stats of StrictAuth Apps
+	ScopeRead = "read"
+	// ScopeAdmin allows a key to manage the keys and token of its App
+	ScopeAdmin = "admin"
+)
+
+// Key is a named, revocable credential of an App limited to a set of
+// scopes. Token is only returned when the Key is created
+type Key struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	Token     string     `json:"token,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
@@ -0,0 +1,15 @@
+package models
+
+// Percentiles summarizes the distribution of an actions observed
+// values (ex: latencies in milliseconds). Every percentile is within
+// RelativeError of the true value
+type Percentiles struct {
+	Count         uint64  `json:"count"`
+	Min           float64 `json:"min"`
+	Avg           float64 `json:"avg"`
+	P50           float64 `json:"p50"`
+	P90           float64 `json:"p90"`
+	P99           float64 `json:"p99"`
+	Max           float64 `json:"max"`
+	RelativeError float64 `json:"relativeError"`
+}
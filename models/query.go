@@ -0,0 +1,63 @@
+package models
+
+// ActionQuery contains the counts of several actions over the same
+// range along with ratios derived from them
+type ActionQuery struct {
+	Actions []QueryCount `json:"actions"`
+	Total   int64        `json:"total"`
+	Funnel  []FunnelStep `json:"funnel,omitempty"`
+}
+
+// QueryCount contains the count of a single action of an ActionQuery
+type QueryCount struct {
+	Action string   `json:"action"`
+	Count  int64    `json:"count"`
+	Share  *float64 `json:"share"` // Count / Total, nil if Total is 0
+	Ratio  *float64 `json:"ratio"` // Count / count of the first action, nil if it's 0
+}
+
+// FunnelStep contains the conversion from one step of a funnel to the next
+type FunnelStep struct {
+	From       string   `json:"from"`
+	To         string   `json:"to"`
+	Conversion *float64 `json:"conversion"` // To count / From count, nil if From count is 0
+	DropOff    int64    `json:"dropOff"`
+}
+
+// NewActionQuery derives an ActionQuery from the counts of the passed
+// actions. If funnel is true the actions are treated as ordered steps
+// and the conversion between every consecutive pair is included
+func NewActionQuery(actions []string, counts []int64, funnel bool) *ActionQuery {
+	q := &ActionQuery{Actions: make([]QueryCount, len(actions))}
+	for _, count := range counts {
+		q.Total += count
+	}
+	for i, action := range actions {
+		q.Actions[i] = QueryCount{
+			Action: action,
+			Count:  counts[i],
+			Share:  ratio(counts[i], q.Total),
+			Ratio:  ratio(counts[i], counts[0]),
+		}
+	}
+	if funnel {
+		for i := 1; i < len(actions); i++ {
+			q.Funnel = append(q.Funnel, FunnelStep{
+				From:       actions[i-1],
+				To:         actions[i],
+				Conversion: ratio(counts[i], counts[i-1]),
+				DropOff:    counts[i-1] - counts[i],
+			})
+		}
+	}
+	return q
+}
+
+// ratio returns a / b, or nil if b is 0
+func ratio(a, b int64) *float64 {
+	if b == 0 {
+		return nil
+	}
+	r := float64(a) / float64(b)
+	return &r
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// SeriesPoint is the total count of actions within a single
+// interval of a time-series
+type SeriesPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Count     int64     `json:"count"`
+}
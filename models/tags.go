@@ -0,0 +1,94 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+const (
+	// MaxTags is the maximum number of tags an action may have
+	MaxTags = 5
+	// maxTagLength is the maximum length of a tag key or value
+	maxTagLength = 32
+)
+
+var (
+	// ErrTooManyTags is returned when more than MaxTags are parsed
+	ErrTooManyTags = errors.New("Too many tags")
+	// ErrInvalidTag is returned when a tag isn't formatted as key:value
+	// using only letters, digits, '.', '_' and '-'
+	ErrInvalidTag = errors.New("Tags must be formatted as key:value using only letters, digits, '.', '_' and '-'")
+)
+
+// Tags are key/value dimensions attached to an action
+// (ex: platform:ios, country:us)
+type Tags map[string]string
+
+// ParseTags parses tags formatted as key:value,key:value
+func ParseTags(s string) (Tags, error) {
+	tags := make(Tags)
+	if s == "" {
+		return tags, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, ":", 2)
+		if len(kv) != 2 || !validTagPart(kv[0]) || !validTagPart(kv[1]) {
+			return nil, ErrInvalidTag
+		}
+		tags[kv[0]] = kv[1]
+	}
+	if len(tags) > MaxTags {
+		return nil, ErrTooManyTags
+	}
+	return tags, nil
+}
+
+// String returns the canonical form of the tags, formatted
+// as key:value,key:value and sorted by key
+func (t Tags) String() string {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + ":" + t[k]
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Validate checks that the tags are within the same limits
+// enforced by ParseTags
+func (t Tags) Validate() error {
+	_, err := ParseTags(t.String())
+	return err
+}
+
+// Matches reports whether every tag in filter is also in t
+func (t Tags) Matches(filter Tags) bool {
+	for k, v := range filter {
+		if t[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// validTagPart reports whether s is a valid tag key or value
+func validTagPart(s string) bool {
+	if s == "" || len(s) > maxTagLength {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '.', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// TokenRotation contains the new token of an App and when its
+// previous token stops being accepted
+type TokenRotation struct {
+	Token                  string     `json:"token"`
+	PreviousTokenExpiresAt *time.Time `json:"previousTokenExpiresAt,omitempty"` // nil if revoked immediately
+}
@@ -0,0 +1,17 @@
+package models
+
+// UniqueIDs contains the identifiers (ex: user or session IDs)
+// submitted to count the unique visitors of an action
+type UniqueIDs struct {
+	IDs []string `json:"ids"`
+}
+
+// UniqueCount contains the approximate number of distinct
+// identifiers submitted for an action. The count is expected to be
+// within StandardError (relative) of the true count about 68% of the
+// time, within twice that about 95% of the time and within three
+// times that about 99% of the time
+type UniqueCount struct {
+	Count         uint64  `json:"count"`
+	StandardError float64 `json:"standardError"`
+}
@@ -0,0 +1,199 @@
+package sketch
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+)
+
+const (
+	// histogramGamma is the ratio between the upper and lower bounds
+	// of every histogram bin
+	histogramGamma = 1.02
+	// minHistogramValue is the smallest value given its own bin.
+	// Anything smaller (including negatives) is counted as zero
+	minHistogramValue = 1e-9
+	// maxHistogramBins is the maximum number of bins a Histogram
+	// keeps before collapsing its lowest bins
+	maxHistogramBins = 4096
+	// maxHistogramIndex is the largest bin index a finite float64
+	// can fall into
+	maxHistogramIndex = 36000
+)
+
+// HistogramRelativeError is the maximum relative error of every
+// quantile returned by a Histogram, roughly 1%
+var HistogramRelativeError = (histogramGamma - 1) / (histogramGamma + 1)
+
+// logGamma is cached as it's needed for every added value
+var logGamma = math.Log(histogramGamma)
+
+// ErrInvalidHistogram is returned when decoding inconsistent
+// Histogram data
+var ErrInvalidHistogram = errors.New("Invalid histogram data")
+
+// Histogram is a mergeable distribution of values (ex: latencies)
+// kept in logarithmically sized bins so that every quantile can be
+// estimated within HistogramRelativeError of its true value. Once it
+// has more than maxHistogramBins bins the lowest are collapsed into
+// one another, so only the smallest quantiles lose accuracy
+type Histogram struct {
+	Bins  map[int]uint64 `json:"bins"` // bin index -> count
+	Zero  uint64         `json:"zero"` // Values below minHistogramValue
+	Count uint64         `json:"count"`
+	Sum   float64        `json:"sum"`
+	Min   float64        `json:"min"`
+	Max   float64        `json:"max"`
+}
+
+// NewHistogram generates a new empty Histogram
+func NewHistogram() *Histogram {
+	return &Histogram{Bins: make(map[int]uint64)}
+}
+
+// Add adds a single value to the Histogram. NaN and infinite values
+// are ignored
+func (h *Histogram) Add(value float64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+	if h.Count == 0 || value < h.Min {
+		h.Min = value
+	}
+	if h.Count == 0 || value > h.Max {
+		h.Max = value
+	}
+	h.Count++
+	h.Sum += value
+
+	if value < minHistogramValue {
+		h.Zero++
+		return
+	}
+	if h.Bins == nil {
+		h.Bins = make(map[int]uint64)
+	}
+	h.Bins[int(math.Ceil(math.Log(value)/logGamma))]++
+	h.collapse()
+}
+
+// Merge adds every value of other to the Histogram
+func (h *Histogram) Merge(other *Histogram) {
+	if other.Count == 0 {
+		return
+	}
+	if h.Count == 0 || other.Min < h.Min {
+		h.Min = other.Min
+	}
+	if h.Count == 0 || other.Max > h.Max {
+		h.Max = other.Max
+	}
+	h.Count += other.Count
+	h.Sum += other.Sum
+	h.Zero += other.Zero
+	if h.Bins == nil {
+		h.Bins = make(map[int]uint64)
+	}
+	for index, count := range other.Bins {
+		h.Bins[index] += count
+	}
+	h.collapse()
+}
+
+// collapse merges the lowest bins into the lowest bin being kept until
+// at most maxHistogramBins remain
+func (h *Histogram) collapse() {
+	if len(h.Bins) <= maxHistogramBins {
+		return
+	}
+	indexes := make([]int, 0, len(h.Bins))
+	for index := range h.Bins {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	excess := len(indexes) - maxHistogramBins
+	into := indexes[excess]
+	for _, index := range indexes[:excess] {
+		h.Bins[into] += h.Bins[index]
+		delete(h.Bins, index)
+	}
+}
+
+// Quantile estimates the value below which the passed fraction
+// (0 to 1) of all values fall. Zero is returned for an empty
+// Histogram
+func (h *Histogram) Quantile(q float64) float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	if q <= 0 {
+		return h.Min
+	}
+	if q >= 1 {
+		return h.Max
+	}
+
+	// Walk the bins in order until the rank of q is passed
+	rank := q * float64(h.Count-1)
+	seen := float64(h.Zero)
+	if seen > rank {
+		return math.Max(h.Min, 0)
+	}
+	indexes := make([]int, 0, len(h.Bins))
+	for index := range h.Bins {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		seen += float64(h.Bins[index])
+		if seen > rank {
+			// Use the value with the least relative error to
+			// every value in the bin
+			value := 2 * math.Pow(histogramGamma, float64(index)) / (histogramGamma + 1)
+			return math.Min(math.Max(value, h.Min), h.Max)
+		}
+	}
+	return h.Max
+}
+
+// Mean returns the average of all values in the Histogram
+func (h *Histogram) Mean() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / float64(h.Count)
+}
+
+// UnmarshalJSON decodes a Histogram, validating that it's consistent.
+// Histograms with too many bins are collapsed rather than rejected so
+// that any stored Histogram can always be decoded
+func (h *Histogram) UnmarshalJSON(data []byte) error {
+	type histogram Histogram // Prevent recursion
+	var decoded histogram
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if decoded.Min > decoded.Max || math.IsInf(decoded.Sum, 0) || math.IsNaN(decoded.Sum) {
+		return ErrInvalidHistogram
+	}
+	total := decoded.Zero
+	for index, count := range decoded.Bins {
+		if index > maxHistogramIndex || index < -maxHistogramIndex {
+			return ErrInvalidHistogram
+		}
+		if total+count < total {
+			return ErrInvalidHistogram // The total overflowed
+		}
+		total += count
+	}
+	if total != decoded.Count {
+		return ErrInvalidHistogram
+	}
+	*h = Histogram(decoded)
+	if h.Bins == nil {
+		h.Bins = make(map[int]uint64)
+	}
+	h.collapse()
+	return nil
+}
@@ -0,0 +1,148 @@
+package sketch
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// checkQuantile fails the test if value isn't within the relative
+// error of every Histogram quantile of expected
+func checkQuantile(t *testing.T, q, value, expected float64) {
+	t.Helper()
+	if math.Abs(value-expected) > HistogramRelativeError*expected*(1+1e-9) {
+		t.Errorf("Expected quantile %v to be within %.1f%% of %v, got %v",
+			q, 100*HistogramRelativeError, expected, value)
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	h := NewHistogram()
+	for i := 1; i <= 10000; i++ {
+		h.Add(float64(i))
+	}
+	if h.Count != 10000 || h.Min != 1 || h.Max != 10000 || h.Mean() != 5000.5 {
+		t.Errorf("Expected exact count, min, max and mean, got %+v (mean %v)", h, h.Mean())
+	}
+	for _, q := range []float64{0.01, 0.25, 0.5, 0.9, 0.99, 0.999} {
+		expected := math.Floor(q*9999) + 1
+		checkQuantile(t, q, h.Quantile(q), expected)
+	}
+	if h.Quantile(0) != 1 || h.Quantile(1) != 10000 {
+		t.Errorf("Expected the extreme quantiles to be the min and max")
+	}
+}
+
+func TestHistogramZero(t *testing.T) {
+	h := NewHistogram()
+	for _, value := range []float64{-5, 0, 0, math.NaN(), math.Inf(1), 10} {
+		h.Add(value)
+	}
+	if h.Count != 4 || h.Zero != 3 || h.Min != -5 || h.Max != 10 {
+		t.Errorf("Expected 4 values, 3 of them zero, got %+v", h)
+	}
+	if q := h.Quantile(0.5); q != 0 {
+		t.Errorf("Expected the median to be 0, got %v", q)
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	a, b, all := NewHistogram(), NewHistogram(), NewHistogram()
+	for i := 1; i <= 10000; i++ {
+		value := float64(i) / 10
+		if i%3 == 0 {
+			a.Add(value)
+		} else {
+			b.Add(value)
+		}
+		all.Add(value)
+	}
+
+	// Merging keeps every value exactly as if they were all added to
+	// a single Histogram
+	a.Merge(b)
+	if a.Count != all.Count || a.Min != all.Min || a.Max != all.Max ||
+		math.Abs(a.Sum-all.Sum) > 1e-6 {
+		t.Errorf("Expected the merged Histogram to match, got %+v", a)
+	}
+	for _, q := range []float64{0.1, 0.5, 0.9, 0.99} {
+		if a.Quantile(q) != all.Quantile(q) {
+			t.Errorf("Expected merged quantile %v to be %v, got %v", q, all.Quantile(q), a.Quantile(q))
+		}
+		checkQuantile(t, q, a.Quantile(q), (math.Floor(q*9999)+1)/10)
+	}
+}
+
+func TestHistogramCollapse(t *testing.T) {
+	// Spread values over more bins than a Histogram keeps, halving
+	// them between two Histograms so the merge must collapse them
+	a, b := NewHistogram(), NewHistogram()
+	n := maxHistogramBins + 1000
+	for i := 0; i < n; i++ {
+		value := math.Pow(histogramGamma, float64(i)+0.5)
+		if i%2 == 0 {
+			a.Add(value)
+		} else {
+			b.Add(value)
+		}
+	}
+	if len(a.Bins) > maxHistogramBins || len(b.Bins) > maxHistogramBins {
+		t.Fatalf("Expected at most %d bins before merging", maxHistogramBins)
+	}
+	a.Merge(b)
+	if len(a.Bins) != maxHistogramBins || a.Count != uint64(n) {
+		t.Fatalf("Expected %d bins and %d values, got %d and %d",
+			maxHistogramBins, n, len(a.Bins), a.Count)
+	}
+
+	// Only the lowest quantiles lose accuracy
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		expected := math.Pow(histogramGamma, math.Floor(q*float64(n-1))+0.5)
+		checkQuantile(t, q, a.Quantile(q), expected)
+	}
+
+	// A collapsed Histogram can always be encoded and decoded
+	data, err := json.Marshal(a)
+	if err != nil {
+		t.Fatalf("Failed to marshal Histogram: %v", err)
+	}
+	var decoded Histogram
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal collapsed Histogram: %v", err)
+	}
+	if decoded.Count != a.Count || len(decoded.Bins) != len(a.Bins) {
+		t.Errorf("Expected the decoded Histogram to match, got %d values in %d bins",
+			decoded.Count, len(decoded.Bins))
+	}
+}
+
+func TestHistogramUnmarshal(t *testing.T) {
+	// Histograms with too many bins are collapsed when decoded
+	bins := make([]string, maxHistogramBins+10)
+	for i := range bins {
+		bins[i] = fmt.Sprintf(`"%d":1`, i)
+	}
+	data := fmt.Sprintf(`{"bins":{%s},"count":%d,"sum":1,"min":1,"max":1e10}`,
+		strings.Join(bins, ","), len(bins))
+	var h Histogram
+	if err := json.Unmarshal([]byte(data), &h); err != nil {
+		t.Fatalf("Failed to unmarshal Histogram with too many bins: %v", err)
+	}
+	if len(h.Bins) != maxHistogramBins || h.Count != uint64(len(bins)) {
+		t.Errorf("Expected %d bins, got %d", maxHistogramBins, len(h.Bins))
+	}
+
+	// Inconsistent Histograms are rejected
+	for _, data := range []string{
+		`{"bins":{"1":2},"count":1,"min":1,"max":2}`,
+		`{"bins":{"1":1},"count":1,"min":2,"max":1}`,
+		`{"bins":{"99999":1},"count":1,"min":1,"max":2}`,
+		`{"bins":{"1":18446744073709551615,"2":2},"count":1,"min":1,"max":2}`,
+	} {
+		if err := json.Unmarshal([]byte(data), &h); err != ErrInvalidHistogram {
+			t.Errorf("Expected %s to return ErrInvalidHistogram, got %v", data, err)
+		}
+	}
+}
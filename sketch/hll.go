@@ -0,0 +1,107 @@
+// Package sketch contains compact, mergeable data structures used to
+// summarize metrics that can't simply be summed
+package sketch
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+const (
+	// hllPrecision is the number of hash bits used to pick a register
+	hllPrecision = 12
+	// hllRegisters is the number of registers in every HLL (2^precision)
+	hllRegisters = 1 << hllPrecision
+)
+
+// HLLStandardError is the relative standard error of every count
+// returned by an HLL (1.04 / sqrt(registers)), roughly 1.6%
+var HLLStandardError = 1.04 / math.Sqrt(hllRegisters)
+
+// ErrInvalidHLL is returned when unmarshaling malformed HLL data
+var ErrInvalidHLL = errors.New("Invalid HyperLogLog data")
+
+// HLL is a HyperLogLog sketch that approximates the number of
+// distinct identifiers added to it using a fixed 4KB of memory
+type HLL struct {
+	registers [hllRegisters]uint8
+}
+
+// NewHLL generates a new empty HLL
+func NewHLL() *HLL { return &HLL{} }
+
+// Add adds an identifier to the HLL
+func (h *HLL) Add(id string) {
+	x := hash64(id)
+	index := x >> (64 - hllPrecision)
+	// Guard bit prevents counting past the remaining hash bits
+	w := x<<hllPrecision | 1<<(hllPrecision-1)
+	if rho := uint8(bits.LeadingZeros64(w) + 1); rho > h.registers[index] {
+		h.registers[index] = rho
+	}
+}
+
+// Merge adds every identifier counted by other to the HLL
+func (h *HLL) Merge(other *HLL) {
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+// Count returns the approximate number of distinct identifiers
+// added to the HLL
+func (h *HLL) Count() uint64 {
+	m := float64(hllRegisters)
+	var sum float64
+	var zeros int
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	// Use linear counting for small cardinalities
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// MarshalBinary encodes the HLL as its precision followed by
+// every register
+func (h *HLL) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 1+hllRegisters)
+	data[0] = hllPrecision
+	copy(data[1:], h.registers[:])
+	return data, nil
+}
+
+// UnmarshalBinary decodes an HLL encoded by MarshalBinary
+func (h *HLL) UnmarshalBinary(data []byte) error {
+	if len(data) != 1+hllRegisters || data[0] != hllPrecision {
+		return ErrInvalidHLL
+	}
+	copy(h.registers[:], data[1:])
+	return nil
+}
+
+// hash64 hashes the passed identifier using FNV-1a followed by
+// a finalizer to evenly distribute its bits
+func hash64(id string) uint64 {
+	f := fnv.New64a()
+	f.Write([]byte(id))
+	x := f.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
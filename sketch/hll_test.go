@@ -0,0 +1,75 @@
+package sketch
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+// addIDs adds every identifier in [from, to) to the HLL
+func addIDs(h *HLL, from, to int) {
+	for i := from; i < to; i++ {
+		h.Add("user-" + strconv.Itoa(i))
+	}
+}
+
+// checkCount fails the test if count isn't within three standard
+// errors of expected, which holds about 99% of the time
+func checkCount(t *testing.T, count uint64, expected int) {
+	t.Helper()
+	if expected == 0 {
+		if count != 0 {
+			t.Errorf("Expected a count of 0, got %d", count)
+		}
+		return
+	}
+	relErr := math.Abs(float64(count)-float64(expected)) / float64(expected)
+	if relErr > 3*HLLStandardError {
+		t.Errorf("Expected a count within %.1f%% of %d, got %d (%.1f%%)",
+			300*HLLStandardError, expected, count, 100*relErr)
+	}
+}
+
+func TestHLLCount(t *testing.T) {
+	for _, n := range []int{0, 10, 1000, 10000, 100000, 1000000} {
+		h := NewHLL()
+		addIDs(h, 0, n)
+		addIDs(h, 0, n) // Duplicates aren't counted again
+		checkCount(t, h.Count(), n)
+	}
+}
+
+func TestHLLMerge(t *testing.T) {
+	a, b, all := NewHLL(), NewHLL(), NewHLL()
+	addIDs(a, 0, 60000)
+	addIDs(b, 40000, 100000)
+	addIDs(all, 0, 100000)
+
+	// Merging overlapping sets counts their union exactly as if every
+	// identifier was added to a single HLL
+	a.Merge(b)
+	if a.Count() != all.Count() {
+		t.Errorf("Expected the merged count to be %d, got %d", all.Count(), a.Count())
+	}
+	checkCount(t, a.Count(), 100000)
+}
+
+func TestHLLMarshal(t *testing.T) {
+	h := NewHLL()
+	addIDs(h, 0, 5000)
+	data, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to marshal HLL: %v", err)
+	}
+
+	decoded := NewHLL()
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Failed to unmarshal HLL: %v", err)
+	}
+	if decoded.Count() != h.Count() {
+		t.Errorf("Expected the decoded count to be %d, got %d", h.Count(), decoded.Count())
+	}
+	if err := decoded.UnmarshalBinary(data[1:]); err != ErrInvalidHLL {
+		t.Errorf("Expected truncated data to return ErrInvalidHLL, got %v", err)
+	}
+}